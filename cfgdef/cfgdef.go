@@ -1,5 +1,11 @@
 package cfgdef
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
 // ExportFlags 导出参数
 var ExportFlags = struct {
 	XLSPath    string
@@ -10,6 +16,25 @@ var ExportFlags = struct {
 	CSPath     string
 	UCSPath    string
 	UseFor     string
+	TimeZone   string
+	CPPTypes   string
+	FixedBits  uint
+	I18NPath   string
+	I18NFormat string
+	Langs      string
+	AssetPath  string
+	AssetMeta  bool
+	BackRefs   bool
+	GoEmbed    bool
+	CPPJSON    string
+	CPPRuntime bool
+	CPPNS      string
+	CSNet      bool
+	CSEnum     string
+	CSAttr     string
+	CSFields   bool
+	CSUnity    bool
+	UAsset     bool
 }{}
 
 // EnumItem 枚举项
@@ -23,10 +48,28 @@ type EnumItem struct {
 type EnumDef struct {
 	Name     string               // 名称
 	Desc     string               // 描述
+	Type     string               // 底层整数类型, 为空时使用各语言默认的枚举类型
+	IsFlags  bool                 // 是否是可按位组合的标记枚举
 	Items    map[int]*EnumItem    // 枚举项
 	ItemsMap map[string]*EnumItem // 枚举项
 }
 
+// UnionItem 联合体变体
+type UnionItem struct {
+	Name   string // 判别枚举项
+	Struct string // 数据结构体, 为空时没有数据
+	Desc   string // 描述
+}
+
+// UnionDef 联合体信息, 由判别枚举选择数据结构体
+type UnionDef struct {
+	Name     string                // 名称
+	Desc     string                // 描述
+	Enum     string                // 判别枚举
+	Items    map[int]*UnionItem    // 变体
+	ItemsMap map[string]*UnionItem // 变体
+}
+
 // FieldDef 字段
 type FieldDef struct {
 	Name     string    // 字段名
@@ -36,12 +79,66 @@ type FieldDef struct {
 	IsKey    bool      // 是否是键值
 	IsEnum   bool      // 是否是枚举
 	IsStruct bool      // 是否是结构体
+	IsUnion  bool      // 是否是联合体
 	UseFor   string    // 字段用途
 	Len      []uint    // 数组元素个数或字符串长度范围
+	Width    []uint    // 字符串显示宽度范围, 全角字符的宽度为2
 	Range    []float64 // 数值取值范围
+	Pattern  string    // 字符串格式, 正则表达式
+	In       []string  // 可选值
+	PathRoot string    // 文件路径的根目录
+	Asset    *AssetDef // 资源引用
 	FTable   string    // 外键关联表
 }
 
+// AssetDef 资源引用约束, 资源路径相对于客户端工程目录下的根目录
+type AssetDef struct {
+	Root string   // 根目录, 如: Assets/Art/Icons
+	Exts []string // 扩展名, 单元格中的路径没有扩展名时依次尝试, 如: .png .jpg
+}
+
+// RowPos 数据行来源
+type RowPos struct {
+	File  string // 文件
+	Sheet string // 工作表
+	Row   int    // 行号(从0开始)
+}
+
+// String 数据行位置
+func (pos *RowPos) String() string {
+	return fmt.Sprintf("%s[%s]:%d", pos.File, pos.Sheet, pos.Row+1)
+}
+
+// Cell 单元格位置
+func (pos *RowPos) Cell(col int) string {
+	return fmt.Sprintf("%s[%s]!%s%d", pos.File, pos.Sheet, GetColName(col), pos.Row+1)
+}
+
+// TextItem 本地化文本
+type TextItem struct {
+	ID   string  // 文本ID, 如: ItemTable.1001.Name
+	Text string  // 源语言文本
+	Desc string  // 字段描述, 作为翻译时的上下文
+	Pos  *RowPos // 数据来源
+}
+
+// RuleDef 校验规则
+type RuleDef struct {
+	Table string // 表格, 为空时为全局规则只求值一次
+	Expr  string // 表达式
+	Desc  string // 描述
+	Pos   string // 规则所在单元格
+}
+
+// RefItem 外键引用
+type RefItem struct {
+	Table string  // 被引用的表格
+	Key   string  // 被引用的主键
+	From  string  // 引用方数据行, 如: ShopTable.1
+	Field string  // 引用方字段, 如: Rewards[2].ItemID
+	Pos   *RowPos // 引用方数据来源
+}
+
 // TableDef 表格定义
 type TableDef struct {
 	Name      string               // 名称
@@ -51,12 +148,20 @@ type TableDef struct {
 	FieldsMap map[string]*FieldDef // 字段
 	Data      map[int][]string     // 数据
 	DataMap   map[string][]string  // 数据
+	DataPos   map[int]*RowPos      // 数据来源
+	KeyRows   map[string]int       // 主键所在数据行
+	Sheets    []string             // 定义来源
 }
 
 // CfgMap 配置信息
 type CfgMap struct {
 	EnumMap  map[string]*EnumDef
+	UnionMap map[string]*UnionDef
 	TableMap map[string]*TableDef
+	Rules    []*RuleDef           // 校验规则
+	Texts    []*TextItem          // 本地化文本
+	Refs     []*RefItem           // 外键引用, 导出JSON数据时收集
+	TextMap  map[string]*TextItem // 本地化文本
 }
 
 // NewEnumDef 构建EnumDef
@@ -68,6 +173,15 @@ func NewEnumDef(name string) *EnumDef {
 	}
 }
 
+// NewUnionDef 构建UnionDef
+func NewUnionDef(name string) *UnionDef {
+	return &UnionDef{
+		Name:     name,
+		Items:    make(map[int]*UnionItem),
+		ItemsMap: make(map[string]*UnionItem),
+	}
+}
+
 // NewTableDef 构建NewTableDef
 func NewTableDef(name string) *TableDef {
 	return &TableDef{
@@ -77,6 +191,8 @@ func NewTableDef(name string) *TableDef {
 		FieldsMap: make(map[string]*FieldDef),
 		Data:      make(map[int][]string),
 		DataMap:   make(map[string][]string),
+		DataPos:   make(map[int]*RowPos),
+		KeyRows:   make(map[string]int),
 	}
 }
 
@@ -84,8 +200,128 @@ func NewTableDef(name string) *TableDef {
 func NewCfgMap() *CfgMap {
 	return &CfgMap{
 		EnumMap:  make(map[string]*EnumDef),
+		UnionMap: make(map[string]*UnionDef),
 		TableMap: make(map[string]*TableDef),
+		TextMap:  make(map[string]*TextItem),
+	}
+}
+
+// AddText 登记本地化文本, 文本ID重复时返回false
+func (cfgMap *CfgMap) AddText(item *TextItem) bool {
+	if _, ok := cfgMap.TextMap[item.ID]; ok {
+		return false
+	}
+	cfgMap.Texts = append(cfgMap.Texts, item)
+	cfgMap.TextMap[item.ID] = item
+	return true
+}
+
+// GetRelateTable 外键关联的表格名称, 不含Table后缀, 如: F[Item] 和 F[ItemTable] 都返回Item,
+// 关联字段值或者枚举时返回空字符串, 不生成关联字段
+func (cfgMap *CfgMap) GetRelateTable(ftable string) string {
+	if ftable == "" || strings.Contains(ftable, ".") {
+		return ""
+	}
+	if _, ok := cfgMap.EnumMap[ftable]; ok {
+		return ""
+	}
+	name := ftable
+	if _, ok := cfgMap.TableMap[name]; !ok {
+		name += "Table"
+	}
+	if tableDef, ok := cfgMap.TableMap[name]; ok && tableDef.Key >= 0 && strings.HasSuffix(name, "Table") {
+		return strings.TrimSuffix(name, "Table")
+	}
+	return ""
+}
+
+// IsReferenced 表格是否被外键关联, 包括结构体中的外键
+func (cfgMap *CfgMap) IsReferenced(name string) bool {
+	for _, tableDef := range cfgMap.TableMap {
+		for _, field := range tableDef.Fields {
+			if t := cfgMap.GetRelateTable(field.FTable); t != "" && t+"Table" == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NeedRelate 表格、结构体或者联合体中是否有需要关联的字段, 包括嵌套的结构体和联合体中的外键
+func (cfgMap *CfgMap) NeedRelate(name string) bool {
+	return cfgMap.needRelate(name, make(map[string]bool))
+}
+
+func (cfgMap *CfgMap) needRelate(name string, visited map[string]bool) bool {
+	if visited[name] {
+		return false
+	}
+	visited[name] = true
+	if unionDef := cfgMap.UnionMap[name]; unionDef != nil {
+		for _, item := range unionDef.Items {
+			if item.Struct != "" && cfgMap.needRelate(item.Struct, visited) {
+				return true
+			}
+		}
+		return false
+	}
+	tableDef := cfgMap.TableMap[name]
+	if tableDef == nil {
+		return false
+	}
+	for _, field := range tableDef.Fields {
+		if field.Name == "" || field.Type == "" ||
+			!(field.IsKey || field.UseFor == "A" || field.UseFor == ExportFlags.UseFor) {
+			continue
+		}
+		if cfgMap.GetRelateTable(field.FTable) != "" {
+			return true
+		}
+		if (field.IsStruct || field.IsUnion) && cfgMap.needRelate(field.Type, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasFieldType 是否有表格或结构体使用了指定的字段类型
+func (cfgMap *CfgMap) HasFieldType(typeName string) bool {
+	for _, tableDef := range cfgMap.TableMap {
+		for _, field := range tableDef.Fields {
+			if field.Type == typeName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetRangeTypes 获得所有用到的range<T>的元素类型
+func (cfgMap *CfgMap) GetRangeTypes() []string {
+	done := make(map[string]bool)
+	var types []string
+	for _, tableDef := range cfgMap.TableMap {
+		for _, field := range tableDef.Fields {
+			if t := GetRangeType(field.Type); t != "" && !done[t] {
+				done[t] = true
+				types = append(types, t)
+			}
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// GetDataNames 获得所有导出数据的表格和设置的名称, 按名称排序
+func (cfgMap *CfgMap) GetDataNames() []string {
+	var names []string
+	for name := range cfgMap.TableMap {
+		if strings.HasSuffix(name, "Table") || strings.HasSuffix(name, "Settings") {
+			names = append(names, name)
+		}
 	}
+	sort.Strings(names)
+	return names
 }
 
 // AnyField AnyField
@@ -8,6 +8,15 @@ type Generator interface {
 	// GenEnum 生成枚举
 	GenEnum(name string) string
 
+	// GenUnion 生成联合体
+	GenUnion(name string) string
+
 	// GenTable 生成表
 	GenTable(name string) string
 }
+
+// CommonGenerator 需要生成公共文件(如: 公共类型定义)的生成器
+type CommonGenerator interface {
+	// GenCommonFiles 生成公共文件, 返回文件名及文件内容
+	GenCommonFiles() map[string]string
+}
@@ -1,6 +1,31 @@
 package cfgdef
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ErrorCount 已报告的错误数量, WarningCount 已报告的警告数量, 用于check子命令的退出码和汇总
+var ErrorCount, WarningCount int
+
+// Error 输出一条错误并计数, 参数同fmt.Println
+func Error(a ...interface{}) {
+	ErrorCount++
+	fmt.Println(append([]interface{}{"error:"}, a...)...)
+}
+
+// Errorf 输出一条错误并计数, 参数同fmt.Printf
+func Errorf(format string, a ...interface{}) {
+	ErrorCount++
+	fmt.Printf("error: "+format, a...)
+}
+
+// Warning 输出一条警告并计数, 参数同fmt.Println
+func Warning(a ...interface{}) {
+	WarningCount++
+	fmt.Println(append([]interface{}{"warning:"}, a...)...)
+}
 
 // Trim 去掉字符串首尾的空白
 func Trim(s string) string {
@@ -17,6 +42,68 @@ func IsJSONObject(s string) bool {
 	return strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}")
 }
 
+// GetSheetName 获得工作表对应的配置名, 如: ItemTable@weapons -> ItemTable
+func GetSheetName(sheetName string) string {
+	if n := strings.Index(sheetName, "@"); n >= 0 {
+		return Trim(sheetName[:n])
+	}
+	return Trim(sheetName)
+}
+
+// GetIntTypeBits 获得整数类型的位数及是否有符号, 不是整数类型时位数为0
+func GetIntTypeBits(typeName string) (int, bool) {
+	switch typeName {
+	case "int8":
+		return 8, true
+	case "int16":
+		return 16, true
+	case "int32":
+		return 32, true
+	case "int64":
+		return 64, true
+	case "uint8":
+		return 8, false
+	case "uint16":
+		return 16, false
+	case "uint32":
+		return 32, false
+	case "uint64":
+		return 64, false
+	}
+	return 0, false
+}
+
+// GetEnumBaseName 获得枚举去掉Enum或者Flags后缀的名称, 用作枚举项的前缀
+func GetEnumBaseName(name string) string {
+	if strings.HasSuffix(name, "Flags") {
+		return name[:len(name)-5]
+	}
+	return strings.TrimSuffix(name, "Enum")
+}
+
+// IsNumberType 是否是数值类型
+func IsNumberType(typeName string) bool {
+	bits, _ := GetIntTypeBits(typeName)
+	return bits > 0 || typeName == "float32" || typeName == "float64"
+}
+
+// GetRangeType 获得range<T>的元素类型, 不是取值范围类型时返回空
+func GetRangeType(typeName string) string {
+	if strings.HasPrefix(typeName, "range<") && strings.HasSuffix(typeName, ">") {
+		return typeName[6 : len(typeName)-1]
+	}
+	return ""
+}
+
+// GetColName 获得列名, 如: 0->A, 26->AA
+func GetColName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
+
 // GetFieldType 获得字段类型
 func GetFieldType(typeName string) string {
 	if strings.HasPrefix(typeName, "[]") {
@@ -66,10 +153,26 @@ func GetFullFieldType(typeName string) string {
 		return arr + "float32"
 	case "double", "number", "float64":
 		return arr + "float64"
+	case "datetime", "duration", "vec2", "vec3", "color":
+		return arr + fieldType
+	case "fixed", "decimal":
+		return arr + "fixed"
+	case "text", "i18n":
+		return arr + "text"
 	case "":
 		return typeName
 	}
+	//取值范围 range<T>, T为数值类型
+	if strings.HasPrefix(fieldType, "range<") && strings.HasSuffix(fieldType, ">") {
+		elemType := GetFullFieldType(fieldType[6 : len(fieldType)-1])
+		if IsNumberType(elemType) {
+			return arr + "range<" + elemType + ">"
+		}
+		return "?"
+	}
 	if (strings.HasSuffix(typeName, "Enum") && len(fieldType) > 4) ||
+		(strings.HasSuffix(typeName, "Flags") && len(fieldType) > 5) ||
+		(strings.HasSuffix(typeName, "Union") && len(fieldType) > 5) ||
 		(strings.HasSuffix(typeName, "Struct") && len(fieldType) > 6) {
 		return arr + typeName
 	}
@@ -82,3 +185,40 @@ func GetFullTypeName(name string, isArray bool) string {
 	}
 	return name
 }
+
+// 全角字符的范围, 显示宽度为2
+var wideRanges = [][2]rune{
+	{0x1100, 0x115F},   //谚文字母
+	{0x2E80, 0x303E},   //CJK部首、标点
+	{0x3041, 0x33FF},   //假名、CJK符号
+	{0x3400, 0x4DBF},   //CJK扩展A
+	{0x4E00, 0x9FFF},   //CJK统一汉字
+	{0xA000, 0xA4CF},   //彝文
+	{0xAC00, 0xD7A3},   //谚文音节
+	{0xF900, 0xFAFF},   //CJK兼容汉字
+	{0xFE10, 0xFE19},   //竖排标点
+	{0xFE30, 0xFE6F},   //CJK兼容标点
+	{0xFF00, 0xFF60},   //全角字符
+	{0xFFE0, 0xFFE6},   //全角符号
+	{0x1F300, 0x1F64F}, //表情符号
+	{0x1F900, 0x1F9FF}, //表情符号
+	{0x20000, 0x3FFFD}, //CJK扩展B~
+}
+
+// GetDisplayWidth 获得字符串的显示宽度, 全角字符为2, 组合字符和控制字符为0
+func GetDisplayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf, unicode.Cc) {
+			continue
+		}
+		width++
+		for _, wr := range wideRanges {
+			if r >= wr[0] && r <= wr[1] {
+				width++
+				break
+			}
+		}
+	}
+	return width
+}
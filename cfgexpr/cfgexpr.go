@@ -0,0 +1,139 @@
+// Package cfgexpr 配置数据校验规则使用的表达式, 如:
+//
+//	MinLevel <= MaxLevel
+//	sum(DropWeights) == 10000
+//	all(Rewards, ItemTable[it.ItemID].Tradeable)
+//	count(ItemTable, it.Type == ItemTypeEnum.Equip) <= 100
+//
+// 表达式中的名称依次从当前数据行的字段、表格/设置/枚举中查找,
+// all/any/count/sum等函数的第二个参数对每个元素求值, 元素为it.
+package cfgexpr
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expr 编译后的表达式
+type Expr struct {
+	src  string
+	root node
+}
+
+// Table 表格数据, 表达式中可以使用 Table[主键] 获得数据行
+type Table struct {
+	Rows []map[string]interface{}
+	Keys map[string]map[string]interface{}
+}
+
+// Enum 枚举, 表达式中可以使用 Enum.Item 获得枚举值
+type Enum map[string]float64
+
+// Env 表达式求值环境
+type Env struct {
+	Row     map[string]interface{}                // 当前数据行, 没有时为nil
+	Globals func(name string) (interface{}, bool) // 查找表格、设置、枚举等全局名称
+
+	it     interface{}
+	hasIt  bool
+	trace  []string
+	traced map[string]bool
+}
+
+// UndefinedError 表达式中使用了未定义的名称
+type UndefinedError struct {
+	Name string
+}
+
+func (e *UndefinedError) Error() string {
+	return "未定义的名称 " + e.Name
+}
+
+// Compile 编译表达式
+func Compile(src string) (*Expr, error) {
+	p := &parser{lex: newLexer(src)}
+	p.next()
+	root, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, fmt.Errorf("第%d个字符附近有多余的内容: %s", p.tok.pos+1, p.tok.text)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// String 表达式源码
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval 求值
+func (e *Expr) Eval(env *Env) (interface{}, error) {
+	env.trace = nil
+	env.traced = nil
+	return e.root.eval(env)
+}
+
+// Check 求值并检查结果是否为true, 第二个返回值为表达式中引用的名称及其值, 用于输出诊断信息
+func (e *Expr) Check(env *Env) (bool, string, error) {
+	v, err := e.Eval(env)
+	if err != nil {
+		return false, "", err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, "", fmt.Errorf("结果不是bool: %s", FormatValue(v))
+	}
+	return b, strings.Join(env.trace, ", "), nil
+}
+
+// 记录表达式中引用的名称的值, 对元素求值时不记录
+func (env *Env) record(n node, v interface{}) {
+	if env.hasIt {
+		return
+	}
+	s := n.String()
+	if env.traced == nil {
+		env.traced = make(map[string]bool)
+	}
+	if !env.traced[s] {
+		env.traced[s] = true
+		env.trace = append(env.trace, s+"="+FormatValue(v))
+	}
+}
+
+// FormatValue 格式化值, 用于输出诊断信息
+func FormatValue(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "nil"
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case string:
+		return strconv.Quote(x)
+	case bool:
+		return strconv.FormatBool(x)
+	case *Table:
+		return "<" + strconv.Itoa(len(x.Rows)) + "行>"
+	}
+	b, _ := json.Marshal(v)
+	s := string(b)
+	if len(s) > 64 {
+		s = s[:61] + "..."
+	}
+	return s
+}
+
+// ToKey 转换为表格主键, 与表格数据中填写的主键一致, 如: 1001
+func ToKey(v interface{}) string {
+	switch x := v.(type) {
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case string:
+		return strings.TrimSpace(x)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,222 @@
+package cfgexpr
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// newEnv 构建测试用的求值环境, 当前数据行为物品1001
+func newEnv() *Env {
+	items := &Table{Keys: make(map[string]map[string]interface{})}
+	for _, row := range []map[string]interface{}{
+		{"ID": 1001.0, "Type": 1.0, "Level": 3.0},
+		{"ID": 1002.0, "Type": 2.0, "Level": 5.0},
+		{"ID": 1003.0, "Type": 1.0, "Level": 1.0},
+	} {
+		items.Rows = append(items.Rows, row)
+		items.Keys[ToKey(row["ID"])] = row
+	}
+	globals := map[string]interface{}{
+		"ItemTable":    items,
+		"ItemTypeEnum": Enum{"Equip": 1, "Gift": 2},
+	}
+	return &Env{
+		Row: map[string]interface{}{
+			"ID":    1001.0,
+			"Level": 3.0,
+			"Name":  "长剑",
+			"Tags":  []interface{}{"rare", "melee"},
+			"Rewards": []interface{}{
+				map[string]interface{}{"ItemID": 1002.0, "Count": 1.0},
+				map[string]interface{}{"ItemID": 1003.0, "Count": 5.0},
+			},
+			//序列化后超过64个字符, 只有最后的字段不同
+			"Skills": []interface{}{
+				map[string]interface{}{"Desc": strings.Repeat("火", 30), "Value": 100.0},
+				map[string]interface{}{"Desc": strings.Repeat("火", 30), "Value": 200.0},
+			},
+			"Empty": nil,
+		},
+		Globals: func(name string) (interface{}, bool) {
+			v, ok := globals[name]
+			return v, ok
+		},
+	}
+}
+
+// evalTests 表达式及其期望的值
+type evalTests []struct {
+	expr string
+	want interface{}
+}
+
+func (tests evalTests) run(t *testing.T) {
+	t.Helper()
+	for _, tt := range tests {
+		e, err := Compile(tt.expr)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.expr, err)
+			continue
+		}
+		got, err := e.Eval(newEnv())
+		if err != nil {
+			t.Errorf("Eval(%q): %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Eval(%q) = %s, want %s", tt.expr, FormatValue(got), FormatValue(tt.want))
+		}
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	evalTests{
+		{"1 + 2 * 3", 7.0},
+		{"(1 + 2) * 3", 9.0},
+		{"10 - 4 - 3", 3.0},
+		{"12 / 2 / 3", 2.0},
+		{"7 % 4 * 2", 6.0},
+		{"-2 * 3 + 1", -5.0},
+		{"- -2", 2.0},
+		{"1 + 2 == 3", true},
+		{"1 < 2 == 2 < 3", true},
+		{"1 + 1 in [2, 3]", true},
+		{"true || false && false", true},
+		{"(true || false) && false", false},
+		{"not false and false", false},
+		{"!(false && false)", true},
+		{"Level * 2 > 5 and Level - 1 < 5", true},
+		{`"a" + "b" == "ab"`, true},
+		{`"abc" < "abd"`, true},
+	}.run(t)
+}
+
+func TestShortCircuit(t *testing.T) {
+	//右侧有未定义的名称、类型错误或者除数为0, 短路时不求值
+	evalTests{
+		{"false && Nope", false},
+		{"true || Nope", true},
+		{"false and 1 / 0 > 0", false},
+		{"true or 1", true},
+		{"Level > 5 && Nope.X", false},
+		{"Level == 3 || ItemTable[Nope].Level", true},
+		{"Empty == nil || Empty.Count > 0", true},
+		{"true && Level == 3", true},
+		{"false || Level == 3", true},
+	}.run(t)
+
+	//短路时右侧的名称也不出现在诊断信息中
+	e, err := Compile("Level > 5 && Rewards[0].Count > 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, trace, err := e.Check(newEnv())
+	if err != nil || ok || trace != "Level=3" {
+		t.Errorf("Check = %v, %q, %v, want false, \"Level=3\", nil", ok, trace, err)
+	}
+}
+
+func TestIn(t *testing.T) {
+	evalTests{
+		{"Level in [1, 2, 3]", true},
+		{"Level in [4, 5]", false},
+		{"Level in []", false},
+		{`"rare" in Tags`, true},
+		{`"ranged" in Tags`, false},
+		{"1002 in ItemTable", true},
+		{"9999 in ItemTable", false},
+		{"Rewards[0].ItemID in ItemTable", true},
+		{`"剑" in Name`, true},
+		{`"盾" in Name`, false},
+		{"1 in Empty", false},
+		{"not (Level in [1, 2])", true},
+		{"ItemTypeEnum.Gift in [ItemTypeEnum.Equip, ItemTypeEnum.Gift]", true},
+	}.run(t)
+}
+
+func TestHelpers(t *testing.T) {
+	evalTests{
+		{"all(Rewards, it.Count > 0)", true},
+		{"all(Rewards, it.Count > 1)", false},
+		{"any(Rewards, it.ItemID == 1003)", true},
+		{"any(Rewards, it.ItemID == 1001)", false},
+		{"all([], false)", true},
+		{"any([], true)", false},
+		{"all(Empty, false)", true},
+		{"all(Rewards, ItemTable[it.ItemID].Level >= 1)", true},
+		{"any(ItemTable, it.Level > Level)", true},
+		{"all(Rewards, any(ItemTable, it.Type == ItemTypeEnum.Gift))", true},
+		{"count(Rewards)", 2.0},
+		{"count(ItemTable)", 3.0},
+		{"count(ItemTable, it.Type == ItemTypeEnum.Equip)", 2.0},
+		{"count(ItemTable, it.Level > 10)", 0.0},
+		{"count([])", 0.0},
+		{"count(Rewards, it.Count >= 1) == count(Rewards)", true},
+		//any遇到第一个满足条件的元素就结束, all遇到第一个不满足条件的元素就结束
+		{"any(Rewards, it.Count == 1 || it.Nope.X)", true},
+		{"all(Rewards, it.Count == 5 && it.Nope.X)", false},
+	}.run(t)
+}
+
+func TestUnique(t *testing.T) {
+	evalTests{
+		{"unique([1, 2, 3])", true},
+		{"unique([1, 2, 1])", false},
+		{`unique([1, "1"])`, true},
+		{"unique(Tags)", true},
+		{"unique(Rewards, it.ItemID)", true},
+		{"unique(ItemTable, it.Type)", false},
+		{"unique(Skills)", true},
+		{"unique([Skills[0], Skills[1], Skills[0]])", false},
+		{"unique([ItemTable, ItemTable])", false},
+		{"unique([])", true},
+	}.run(t)
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		expr      string
+		undefined string // 期望的未定义名称, 为空时是其他错误
+	}{
+		{"Nope > 1", "Nope"},
+		{"Level > 1 && Nope", "Nope"},
+		{"false || Nope", "Nope"},
+		{"Nope in [1]", "Nope"},
+		{"Level in Nope", "Nope"},
+		{"Nope.Level", "Nope"},
+		{"ItemTable[Nope]", "Nope"},
+		{"it.Count > 0", "it"},
+		{"all(Nope, true)", "Nope"},
+		{"any(Rewards, Nope)", "Nope"},
+		{"count(ItemTable, it.Level > Nope)", "Nope"},
+		{"all(Rewards, it.Count > 0) && it.Count > 0", "it"},
+		{"ItemTypeEnum.Nope == 1", ""},
+		{"Level && true", ""},
+		{"not Level in [1, 2]", ""}, // not的优先级高于in
+		{"1 in Level", ""},
+		{"all(Rewards, it.Count)", ""},
+		{"count(Level)", ""},
+		{"Level / 0", ""},
+	}
+	for _, tt := range tests {
+		e, err := Compile(tt.expr)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.expr, err)
+			continue
+		}
+		v, err := e.Eval(newEnv())
+		if err == nil {
+			t.Errorf("Eval(%q) = %s, want error", tt.expr, FormatValue(v))
+			continue
+		}
+		var undefined *UndefinedError
+		if !errors.As(err, &undefined) {
+			if tt.undefined != "" {
+				t.Errorf("Eval(%q) error = %v, want undefined %s", tt.expr, err, tt.undefined)
+			}
+		} else if undefined.Name != tt.undefined {
+			t.Errorf("Eval(%q) undefined = %q, want %q", tt.expr, undefined.Name, tt.undefined)
+		}
+	}
+}
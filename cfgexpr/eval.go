@@ -0,0 +1,590 @@
+package cfgexpr
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type node interface {
+	eval(env *Env) (interface{}, error)
+	String() string
+}
+
+type literalNode struct {
+	value interface{}
+	text  string
+}
+
+type identNode struct {
+	name string
+}
+
+type memberNode struct {
+	x    node
+	name string
+}
+
+type indexNode struct {
+	x     node
+	index node
+}
+
+type callNode struct {
+	name string
+	fn   *function
+	args []node
+}
+
+type unaryNode struct {
+	op string
+	x  node
+}
+
+type binaryNode struct {
+	op    string
+	left  node
+	right node
+}
+
+type parenNode struct {
+	x node
+}
+
+type arrayNode struct {
+	elems []node
+}
+
+func (n *literalNode) String() string { return n.text }
+func (n *identNode) String() string   { return n.name }
+func (n *memberNode) String() string  { return n.x.String() + "." + n.name }
+func (n *indexNode) String() string   { return n.x.String() + "[" + n.index.String() + "]" }
+func (n *callNode) String() string    { return n.name + "(" + joinNodes(n.args) + ")" }
+func (n *unaryNode) String() string   { return n.op + n.x.String() }
+func (n *binaryNode) String() string  { return n.left.String() + " " + n.op + " " + n.right.String() }
+func (n *parenNode) String() string   { return "(" + n.x.String() + ")" }
+func (n *arrayNode) String() string   { return "[" + joinNodes(n.elems) + "]" }
+
+func joinNodes(nodes []node) string {
+	s := make([]string, len(nodes))
+	for i, n := range nodes {
+		s[i] = n.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+func (n *literalNode) eval(env *Env) (interface{}, error) {
+	return n.value, nil
+}
+
+func (n *identNode) eval(env *Env) (interface{}, error) {
+	if n.name == "it" && env.hasIt {
+		return env.it, nil
+	}
+	if v, ok := env.Row[n.name]; ok {
+		env.record(n, v)
+		return v, nil
+	}
+	if env.Globals != nil {
+		if v, ok := env.Globals(n.name); ok {
+			return v, nil
+		}
+	}
+	return nil, &UndefinedError{Name: n.name}
+}
+
+func (n *memberNode) eval(env *Env) (interface{}, error) {
+	x, err := n.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	switch o := x.(type) {
+	case nil:
+		//不存在的数据行或者空的结构体, 结果为nil
+	case Enum:
+		//枚举项是常量, 不需要记录
+		value, ok := o[n.name]
+		if !ok {
+			return nil, fmt.Errorf("枚举项未定义 %s", n)
+		}
+		return value, nil
+	case map[string]interface{}:
+		v = o[n.name]
+	default:
+		return nil, fmt.Errorf("%s 不是结构体: %s", n.x, FormatValue(x))
+	}
+	env.record(n, v)
+	return v, nil
+}
+
+func (n *indexNode) eval(env *Env) (interface{}, error) {
+	x, err := n.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	i, err := n.index.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	switch o := x.(type) {
+	case nil:
+	case *Table:
+		if row, ok := o.Keys[ToKey(i)]; ok {
+			v = row
+		}
+	case []interface{}:
+		f, ok := i.(float64)
+		if !ok || f != math.Trunc(f) {
+			return nil, fmt.Errorf("%s 不是整数: %s", n.index, FormatValue(i))
+		}
+		if f >= 0 && int(f) < len(o) {
+			v = o[int(f)]
+		}
+	case map[string]interface{}:
+		s, ok := i.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s 不是字符串: %s", n.index, FormatValue(i))
+		}
+		v = o[s]
+	default:
+		return nil, fmt.Errorf("%s 不能使用下标: %s", n.x, FormatValue(x))
+	}
+	env.record(n, v)
+	return v, nil
+}
+
+func (n *callNode) eval(env *Env) (interface{}, error) {
+	v, err := n.fn.call(env, n.args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	env.record(n, v)
+	return v, nil
+}
+
+func (n *unaryNode) eval(env *Env) (interface{}, error) {
+	x, err := n.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		b, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s 不是bool: %s", n.x, FormatValue(x))
+		}
+		return !b, nil
+	}
+	f, ok := x.(float64)
+	if !ok {
+		return nil, fmt.Errorf("%s 不是数字: %s", n.x, FormatValue(x))
+	}
+	return -f, nil
+}
+
+func (n *parenNode) eval(env *Env) (interface{}, error) {
+	return n.x.eval(env)
+}
+
+func (n *arrayNode) eval(env *Env) (interface{}, error) {
+	array := make([]interface{}, len(n.elems))
+	for i, e := range n.elems {
+		v, err := e.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		array[i] = v
+	}
+	return array, nil
+}
+
+func (n *binaryNode) eval(env *Env) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	//逻辑运算短路求值
+	if n.op == "&&" || n.op == "||" {
+		l, ok := left.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s 不是bool: %s", n.left, FormatValue(left))
+		}
+		if (n.op == "&&") != l {
+			return l, nil
+		}
+		right, err := n.right.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := right.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s 不是bool: %s", n.right, FormatValue(right))
+		}
+		return r, nil
+	}
+
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		return contains(right, left, n.right)
+	}
+
+	//字符串比较和连接
+	if ls, ok := left.(string); ok {
+		if rs, ok := right.(string); ok {
+			switch n.op {
+			case "+":
+				return ls + rs, nil
+			case "<":
+				return ls < rs, nil
+			case "<=":
+				return ls <= rs, nil
+			case ">":
+				return ls > rs, nil
+			case ">=":
+				return ls >= rs, nil
+			}
+		}
+	}
+
+	l, ok := left.(float64)
+	if !ok {
+		return nil, fmt.Errorf("%s 不是数字: %s", n.left, FormatValue(left))
+	}
+	r, ok := right.(float64)
+	if !ok {
+		return nil, fmt.Errorf("%s 不是数字: %s", n.right, FormatValue(right))
+	}
+	switch n.op {
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	case ">=":
+		return l >= r, nil
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, fmt.Errorf("%s 除数为0", n)
+		}
+		return l / r, nil
+	case "%":
+		if r == 0 {
+			return nil, fmt.Errorf("%s 除数为0", n)
+		}
+		return math.Mod(l, r), nil
+	}
+	return nil, fmt.Errorf("不支持的运算符 %s", n.op)
+}
+
+func equal(a, b interface{}) bool {
+	switch a.(type) {
+	case nil:
+		return b == nil
+	case float64, string, bool:
+		return a == b
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// x in array: 数组中是否有x; x in Table: 表格中是否有主键x; x in string: 是否是子串
+func contains(container interface{}, x interface{}, n node) (interface{}, error) {
+	switch c := container.(type) {
+	case nil:
+		return false, nil
+	case []interface{}:
+		for _, e := range c {
+			if equal(e, x) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case *Table:
+		_, ok := c.Keys[ToKey(x)]
+		return ok, nil
+	case string:
+		s, ok := x.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s 不是字符串: %s", n, FormatValue(x))
+		}
+		return strings.Contains(c, s), nil
+	}
+	return nil, fmt.Errorf("%s 不是数组、表格或字符串: %s", n, FormatValue(container))
+}
+
+// function 内置函数
+type function struct {
+	minArgs int
+	maxArgs int // -1表示不限
+	call    func(env *Env, args []node) (interface{}, error)
+}
+
+var functions map[string]*function
+
+func init() {
+	functions = map[string]*function{
+		"len":    {1, 1, fnLen},
+		"abs":    {1, 1, fnAbs},
+		"has":    {2, 2, fnHas},
+		"sum":    {1, 2, fnSum},
+		"min":    {1, -1, fnMinMax(-1)},
+		"max":    {1, -1, fnMinMax(1)},
+		"count":  {1, 2, fnCount},
+		"all":    {2, 2, fnAll(true)},
+		"any":    {2, 2, fnAll(false)},
+		"unique": {1, 2, fnUnique},
+	}
+}
+
+// 获得可以遍历的元素, 表格遍历数据行
+func elements(v interface{}, n node) ([]interface{}, error) {
+	switch x := v.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		return x, nil
+	case *Table:
+		rows := make([]interface{}, len(x.Rows))
+		for i, row := range x.Rows {
+			rows[i] = row
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("%s 不是数组或表格: %s", n, FormatValue(v))
+}
+
+// 遍历元素, 有第二个参数时对每个元素(it)求值
+func mapElements(env *Env, args []node) ([]interface{}, error) {
+	v, err := args[0].eval(env)
+	if err != nil {
+		return nil, err
+	}
+	elems, err := elements(v, args[0])
+	if err != nil || len(args) < 2 {
+		return elems, err
+	}
+	it, hasIt := env.it, env.hasIt
+	defer func() {
+		env.it, env.hasIt = it, hasIt
+	}()
+	values := make([]interface{}, len(elems))
+	for i, e := range elems {
+		env.it, env.hasIt = e, true
+		if values[i], err = args[1].eval(env); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func toNumber(v interface{}, n node) (float64, error) {
+	f, ok := v.(float64)
+	if !ok {
+		return 0, fmt.Errorf("%s 不是数字: %s", n, FormatValue(v))
+	}
+	return f, nil
+}
+
+func fnLen(env *Env, args []node) (interface{}, error) {
+	v, err := args[0].eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch x := v.(type) {
+	case nil:
+		return 0.0, nil
+	case string:
+		return float64(utf8.RuneCountInString(x)), nil
+	case []interface{}:
+		return float64(len(x)), nil
+	case map[string]interface{}:
+		return float64(len(x)), nil
+	case *Table:
+		return float64(len(x.Rows)), nil
+	}
+	return nil, fmt.Errorf("%s 没有长度: %s", args[0], FormatValue(v))
+}
+
+func fnAbs(env *Env, args []node) (interface{}, error) {
+	v, err := args[0].eval(env)
+	if err != nil {
+		return nil, err
+	}
+	f, err := toNumber(v, args[0])
+	return math.Abs(f), err
+}
+
+// has(Flags, ElementFlags.Fire) 是否包含全部标志位
+func fnHas(env *Env, args []node) (interface{}, error) {
+	var bits [2]uint64
+	for i, arg := range args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		f, err := toNumber(v, arg)
+		if err != nil {
+			return nil, err
+		}
+		bits[i] = uint64(f)
+	}
+	return bits[0]&bits[1] == bits[1], nil
+}
+
+func fnSum(env *Env, args []node) (interface{}, error) {
+	values, err := mapElements(env, args)
+	if err != nil {
+		return nil, err
+	}
+	sum := 0.0
+	for _, v := range values {
+		f, err := toNumber(v, args[len(args)-1])
+		if err != nil {
+			return nil, err
+		}
+		sum += f
+	}
+	return sum, nil
+}
+
+// min/max(数组[, 表达式]) 或者 min/max(a, b, ...)
+func fnMinMax(sign float64) func(env *Env, args []node) (interface{}, error) {
+	return func(env *Env, args []node) (interface{}, error) {
+		var values []interface{}
+		first, err := args[0].eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := first.(float64); ok {
+			values = append(values, first)
+			for _, arg := range args[1:] {
+				v, err := arg.eval(env)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, v)
+			}
+		} else {
+			if len(args) > 2 {
+				return nil, fmt.Errorf("参数个数错误")
+			}
+			if values, err = mapElements(env, args); err != nil {
+				return nil, err
+			}
+		}
+		var result interface{}
+		for _, v := range values {
+			f, err := toNumber(v, args[len(args)-1])
+			if err != nil {
+				return nil, err
+			}
+			if result == nil || (f-result.(float64))*sign > 0 {
+				result = f
+			}
+		}
+		return result, nil
+	}
+}
+
+func fnCount(env *Env, args []node) (interface{}, error) {
+	values, err := mapElements(env, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < 2 {
+		return float64(len(values)), nil
+	}
+	n := 0
+	for _, v := range values {
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s 不是bool: %s", args[1], FormatValue(v))
+		}
+		if b {
+			n++
+		}
+	}
+	return float64(n), nil
+}
+
+// all: 全部元素满足条件; any: 任一元素满足条件
+func fnAll(all bool) func(env *Env, args []node) (interface{}, error) {
+	return func(env *Env, args []node) (interface{}, error) {
+		v, err := args[0].eval(env)
+		if err != nil {
+			return nil, err
+		}
+		elems, err := elements(v, args[0])
+		if err != nil {
+			return nil, err
+		}
+		it, hasIt := env.it, env.hasIt
+		defer func() {
+			env.it, env.hasIt = it, hasIt
+		}()
+		for i, e := range elems {
+			env.it, env.hasIt = e, true
+			v, err := args[1].eval(env)
+			if err != nil {
+				return nil, err
+			}
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%s 不是bool: %s", args[1], FormatValue(v))
+			}
+			if b != all {
+				//记录第一个不满足all或者满足any的元素
+				env.it, env.hasIt = it, hasIt
+				env.record(&indexNode{x: args[0], index: &literalNode{text: strconv.Itoa(i)}}, e)
+				return b, nil
+			}
+		}
+		return all, nil
+	}
+}
+
+// unique(数组[, 表达式]) 元素是否各不相同
+func fnUnique(env *Env, args []node) (interface{}, error) {
+	values, err := mapElements(env, args)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, v := range values {
+		k := uniqueKey(v)
+		if seen[k] {
+			return false, nil
+		}
+		seen[k] = true
+	}
+	return true, nil
+}
+
+// uniqueKey 比较元素是否相同使用的键, FormatValue会截断较长的值, 表格按实例比较
+func uniqueKey(v interface{}) string {
+	if t, ok := v.(*Table); ok {
+		return fmt.Sprintf("%p", t)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,92 @@
+package cfgexpr
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+	tokError
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+func newLexer(src string) *lexer {
+	return &lexer{src: src}
+}
+
+// 运算符, 较长的在前面
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "+", "-", "*", "/", "%", "!", "(", ")", "[", "]", ",", "."}
+
+func (l *lexer) next() token {
+	for l.pos < len(l.src) && strings.IndexByte(" \t\r\n", l.src[l.pos]) >= 0 {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: start}
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case c >= '0' && c <= '9':
+		for l.pos < len(l.src) && (isDigit(l.src[l.pos]) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		return token{kind: tokNumber, text: l.src[start:l.pos], pos: start}
+	case c == '"' || c == '\'':
+		var sb strings.Builder
+		for l.pos++; l.pos < len(l.src); l.pos++ {
+			if l.src[l.pos] == c {
+				l.pos++
+				return token{kind: tokString, text: sb.String(), pos: start}
+			}
+			if l.src[l.pos] == '\\' && l.pos+1 < len(l.src) {
+				l.pos++
+			}
+			sb.WriteByte(l.src[l.pos])
+		}
+		return token{kind: tokError, text: "字符串没有结束", pos: start}
+	}
+
+	r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+	if r == '_' || unicode.IsLetter(r) {
+		for l.pos < len(l.src) {
+			r, size = utf8.DecodeRuneInString(l.src[l.pos:])
+			if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				break
+			}
+			l.pos += size
+		}
+		return token{kind: tokIdent, text: l.src[start:l.pos], pos: start}
+	}
+	for _, op := range operators {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokOp, text: op, pos: start}
+		}
+	}
+	l.pos += size
+	return token{kind: tokError, text: "无效的字符 " + string(r), pos: start}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,208 @@
+package cfgexpr
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type parser struct {
+	lex *lexer
+	tok token
+}
+
+// 二元运算符的优先级
+var precedences = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3,
+	"<": 4, "<=": 4, ">": 4, ">=": 4, "in": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+}
+
+// 关键字形式的运算符
+var keywordOps = map[string]string{
+	"and": "&&",
+	"or":  "||",
+	"not": "!",
+	"in":  "in",
+}
+
+func (p *parser) next() {
+	p.tok = p.lex.next()
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("第%d个字符附近: %s", p.tok.pos+1, fmt.Sprintf(format, args...))
+}
+
+// 当前的运算符, 关键字形式的运算符会转换为符号形式
+func (p *parser) op() string {
+	if p.tok.kind == tokOp {
+		return p.tok.text
+	} else if p.tok.kind == tokIdent {
+		return keywordOps[p.tok.text]
+	}
+	return ""
+}
+
+func (p *parser) expect(op string) error {
+	if p.tok.kind != tokOp || p.tok.text != op {
+		return p.errorf("缺少 %s", op)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) parseExpr(minPrec int) (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.op()
+		prec := precedences[op]
+		if prec == 0 || prec <= minPrec {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseExpr(prec)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if op := p.op(); op == "!" || op == "-" {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, x: x}, nil
+	}
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	return p.parsePostfix(x)
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokNumber:
+		p.next()
+		v, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("第%d个字符附近: 无效的数字 %s", tok.pos+1, tok.text)
+		}
+		return &literalNode{value: v, text: tok.text}, nil
+	case tokString:
+		p.next()
+		return &literalNode{value: tok.text, text: strconv.Quote(tok.text)}, nil
+	case tokIdent:
+		p.next()
+		switch tok.text {
+		case "true":
+			return &literalNode{value: true, text: tok.text}, nil
+		case "false":
+			return &literalNode{value: false, text: tok.text}, nil
+		case "nil":
+			return &literalNode{value: nil, text: tok.text}, nil
+		}
+		if p.tok.kind == tokOp && p.tok.text == "(" {
+			return p.parseCall(tok)
+		}
+		return &identNode{name: tok.text}, nil
+	case tokOp:
+		switch tok.text {
+		case "(":
+			p.next()
+			x, err := p.parseExpr(0)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return &parenNode{x: x}, nil
+		case "[":
+			p.next()
+			elems, err := p.parseList("]")
+			if err != nil {
+				return nil, err
+			}
+			return &arrayNode{elems: elems}, nil
+		}
+	case tokError:
+		return nil, fmt.Errorf("第%d个字符附近: %s", tok.pos+1, tok.text)
+	case tokEOF:
+		return nil, p.errorf("表达式不完整")
+	}
+	return nil, p.errorf("无效的内容 %s", tok.text)
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("第%d个字符附近: 未定义的函数 %s", name.pos+1, name.text)
+	}
+	p.next()
+	args, err := p.parseList(")")
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, fmt.Errorf("第%d个字符附近: 函数%s的参数个数错误", name.pos+1, name.text)
+	}
+	return &callNode{name: name.text, fn: fn, args: args}, nil
+}
+
+// 解析逗号分隔的表达式列表, 直到结束符号
+func (p *parser) parseList(end string) ([]node, error) {
+	var list []node
+	for !(p.tok.kind == tokOp && p.tok.text == end) {
+		if len(list) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		x, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, x)
+	}
+	p.next()
+	return list, nil
+}
+
+func (p *parser) parsePostfix(x node) (node, error) {
+	for p.tok.kind == tokOp {
+		switch p.tok.text {
+		case ".":
+			p.next()
+			if p.tok.kind != tokIdent {
+				return nil, p.errorf("缺少字段名")
+			}
+			x = &memberNode{x: x, name: p.tok.text}
+			p.next()
+		case "[":
+			p.next()
+			i, err := p.parseExpr(0)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = &indexNode{x: x, index: i}
+		default:
+			return x, nil
+		}
+	}
+	return x, nil
+}
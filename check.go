@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gamewheels/cfgwheel/cfgdef"
+	"github.com/gamewheels/cfgwheel/jsongen"
+)
+
+// 各目标语言的关键字, 字段名、枚举项名不能使用
+var reservedWords = map[string]string{}
+
+func init() {
+	keywords := map[string]string{
+		"Go": "break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var",
+		"C++": "alignas alignof and and_eq asm auto bitand bitor bool break case catch char char8_t char16_t char32_t class compl concept const consteval constexpr constinit const_cast continue co_await co_return co_yield " +
+			"decltype default delete do double dynamic_cast else enum explicit export extern false float for friend goto if inline int long mutable namespace new noexcept not not_eq nullptr " +
+			"operator or or_eq private protected public register reinterpret_cast requires return short signed sizeof static static_assert static_cast struct switch template this thread_local throw true try typedef typeid typename " +
+			"union unsigned using virtual void volatile wchar_t while xor xor_eq",
+		"C#": "abstract as base bool break byte case catch char checked class const continue decimal default delegate do double else enum event explicit extern false finally fixed float for foreach goto if implicit in int interface internal is lock long " +
+			"namespace new null object operator out override params private protected public readonly ref return sbyte sealed short sizeof stackalloc static string struct switch this throw true try typeof uint ulong unchecked unsafe ushort using virtual void volatile while",
+	}
+	for _, lang := range []string{"Go", "C++", "C#"} {
+		for _, w := range strings.Fields(keywords[lang]) {
+			if reservedWords[w] == "" {
+				reservedWords[w] = lang
+			} else {
+				reservedWords[w] += "/" + lang
+			}
+		}
+	}
+}
+
+// 各目标语言都可以使用的标识符
+var identRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// runCheck 检查配置, 执行导出JSON数据时的全部检查和校验规则, 并检查命名规范, 不生成任何文件
+func runCheck() {
+	fmt.Println("\n检查配置数据 ...")
+	gen := jsongen.NewJSONGen(cfgMap)
+	for _, name := range sortedTables() {
+		if !strings.HasSuffix(name, "Struct") {
+			gen.GenTable(name)
+		}
+	}
+	if len(cfgMap.Rules) > 0 {
+		fmt.Println("\n检查校验规则 ...")
+		gen.CheckRules()
+	}
+	fmt.Println("\n检查命名规范 ...")
+	lintCfg()
+}
+
+// lintCfg 检查命名规范: 字段名、枚举项名、联合体名和变体名需要是各目标语言的合法标识符且不是关键字,
+// 表格、字段、枚举、联合体需要填写描述, 枚举、结构体和联合体需要被使用
+func lintCfg() {
+	usedTypes := make(map[string]bool)
+	for _, tableDef := range cfgMap.TableMap {
+		for _, field := range tableDef.Fields {
+			usedTypes[field.Type] = true
+			usedTypes[field.FTable] = true
+		}
+	}
+	for _, unionDef := range cfgMap.UnionMap {
+		usedTypes[unionDef.Enum] = true
+		for _, item := range unionDef.Items {
+			usedTypes[item.Struct] = true
+		}
+	}
+	//校验规则中引用的枚举, 如: ItemTypeEnum.Equip
+	var ruleText strings.Builder
+	for _, rule := range cfgMap.Rules {
+		ruleText.WriteString(rule.Expr + "\n")
+	}
+	ruleWords := make(map[string]bool)
+	for _, w := range regexp.MustCompile(`[\p{L}_][\p{L}\p{N}_]*`).FindAllString(ruleText.String(), -1) {
+		ruleWords[w] = true
+	}
+
+	for _, name := range sortedTables() {
+		tableDef := cfgMap.TableMap[name]
+		if tableDef.Desc == "" {
+			cfgdef.Warning(name, "缺少描述")
+		}
+		if strings.HasSuffix(name, "Struct") && !usedTypes[name] {
+			cfgdef.Warning(name, "结构体没有被使用")
+		}
+		for i := 0; i < len(tableDef.Fields); i++ {
+			field := tableDef.Fields[i]
+			if field == nil || field.Name == "" || field.Type == "" {
+				continue
+			}
+			lintName(name+"."+field.Name, field.Name)
+			if field.Desc == "" {
+				cfgdef.Warning(name+"."+field.Name, "缺少描述")
+			}
+		}
+	}
+
+	var enums []string
+	for name := range cfgMap.EnumMap {
+		enums = append(enums, name)
+	}
+	sort.Strings(enums)
+	for _, name := range enums {
+		enumDef := cfgMap.EnumMap[name]
+		if enumDef.Desc == "" {
+			cfgdef.Warning(name, "缺少描述")
+		}
+		if !usedTypes[name] && !ruleWords[name] {
+			cfgdef.Warning(name, "枚举没有被使用")
+		}
+		for i := 0; i < len(enumDef.Items); i++ {
+			item := enumDef.Items[i]
+			lintName(name+"."+item.Name, item.Name)
+			if item.Desc == "" {
+				cfgdef.Warning(name+"."+item.Name, "缺少描述")
+			}
+		}
+	}
+
+	var unions []string
+	for name := range cfgMap.UnionMap {
+		unions = append(unions, name)
+	}
+	sort.Strings(unions)
+	for _, name := range unions {
+		unionDef := cfgMap.UnionMap[name]
+		lintName(name, name)
+		if unionDef.Desc == "" {
+			cfgdef.Warning(name, "缺少描述")
+		}
+		if !usedTypes[name] {
+			cfgdef.Warning(name, "联合体没有被使用")
+		}
+		for i := 0; i < len(unionDef.Items); i++ {
+			item := unionDef.Items[i]
+			lintName(name+"."+item.Name, item.Name)
+		}
+	}
+}
+
+// lintName 检查名称是否是各目标语言的合法标识符
+func lintName(path string, name string) {
+	if !identRegexp.MatchString(name) {
+		cfgdef.Warning(path, "不是合法的标识符")
+	} else if lang, ok := reservedWords[name]; ok {
+		cfgdef.Warning(path, "是"+lang+"的关键字")
+	}
+}
+
+// sortedTables 按名称排序的表格列表
+func sortedTables() []string {
+	var names []string
+	for name := range cfgMap.TableMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
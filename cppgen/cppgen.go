@@ -2,7 +2,7 @@ package cppgen
 
 import (
 	"bytes"
-	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/gamewheels/cfgwheel/cfgdef"
@@ -11,14 +11,73 @@ import (
 
 // CPPGen C++胶水代码生成器
 type CPPGen struct {
-	cfgMap *cfgdef.CfgMap
+	cfgMap   *cfgdef.CfgMap
+	types    map[string]string
+	includes []string
 }
 
 // NewCPPGen 构建C++胶水代码生成器
 func NewCPPGen(cfgMap *cfgdef.CfgMap) *CPPGen {
-	return &CPPGen{
+	gen := &CPPGen{
 		cfgMap: cfgMap,
+		types:  make(map[string]string),
 	}
+	gen.parseTypes(cfgdef.ExportFlags.CPPTypes)
+	return gen
+}
+
+//解析自定义的内置值类型, 如: vec2=glm::vec2,vec3=glm::vec3,color=glm::vec4,range=MyRange,include=glm/glm.hpp
+func (gen *CPPGen) parseTypes(s string) {
+	for _, kv := range strings.Split(s, ",") {
+		if cfgdef.Trim(kv) == "" {
+			continue
+		}
+		n := strings.Index(kv, "=")
+		if n < 0 {
+			cfgdef.Error("cpptypes格式错误", kv)
+			continue
+		}
+		k, v := cfgdef.Trim(kv[:n]), cfgdef.Trim(kv[n+1:])
+		switch k {
+		case "vec2", "vec3", "color", "range":
+			gen.types[k] = v
+		case "include":
+			gen.includes = append(gen.includes, v)
+		default:
+			cfgdef.Error("cpptypes不支持的类型", k)
+		}
+	}
+}
+
+//获得内置值类型(vec2, vec3, color, range<T>)的类型名, 不是内置值类型时返回空
+func (gen *CPPGen) getValueTypeName(field *cfgdef.FieldDef) string {
+	switch field.Type {
+	case "vec2", "vec3", "color":
+		if t := gen.types[field.Type]; t != "" {
+			return t
+		}
+		return strings.ToUpper(field.Type[:1]) + field.Type[1:]
+	}
+	if elemType := cfgdef.GetRangeType(field.Type); elemType != "" {
+		name := "Range"
+		if t := gen.types["range"]; t != "" {
+			name = t
+		}
+		return name + "<" + getTypeName(&cfgdef.FieldDef{Type: elemType}) + ">"
+	}
+	return ""
+}
+
+//是否使用CfgTypes.h中的默认值类型
+func (gen *CPPGen) isDefaultValueType(field *cfgdef.FieldDef) bool {
+	if cfgdef.GetRangeType(field.Type) != "" {
+		return gen.types["range"] == ""
+	}
+	switch field.Type {
+	case "vec2", "vec3", "color":
+		return gen.types[field.Type] == ""
+	}
+	return false
 }
 
 func genStructName(name string) string {
@@ -31,7 +90,7 @@ func genStructName(name string) string {
 }
 
 func getTypeName(field *cfgdef.FieldDef) string {
-	if field.IsEnum || field.IsStruct {
+	if field.IsEnum || field.IsStruct || field.IsUnion {
 		return field.Type
 	}
 	switch field.Type {
@@ -39,14 +98,48 @@ func getTypeName(field *cfgdef.FieldDef) string {
 		return "float"
 	case "float64":
 		return "double"
-	case "string":
+	case "string", "text":
 		return "std::string"
-	case "byte":
-		return "int8_t"
 	case "bool":
 		return field.Type
+	case "datetime":
+		return "std::chrono::system_clock::time_point"
+	case "duration":
+		return "std::chrono::milliseconds"
+	case "fixed":
+		return "Fixed"
+	}
+	if bits, signed := cfgdef.GetIntTypeBits(field.Type); bits > 0 {
+		if signed {
+			return "int" + strconv.Itoa(bits) + "_t"
+		}
+		return "uint" + strconv.Itoa(bits) + "_t"
+	}
+	return field.Type
+}
+
+//命名空间的开始, cppns为空时不使用命名空间
+func beginNamespace() string {
+	if cfgdef.ExportFlags.CPPNS == "" {
+		return ""
 	}
-	return field.Type + "_t"
+	return "\n\nnamespace " + cfgdef.ExportFlags.CPPNS + "\n{"
+}
+
+//命名空间的结束
+func endNamespace() string {
+	if cfgdef.ExportFlags.CPPNS == "" {
+		return ""
+	}
+	return "\n}"
+}
+
+//获得从全局命名空间开始的名称, 用于在任意命名空间中展开的宏, 如: ::game::cfg::ItemStruct
+func qualifiedName(name string) string {
+	if cfgdef.ExportFlags.CPPNS == "" {
+		return "::" + name
+	}
+	return "::" + cfgdef.ExportFlags.CPPNS + "::" + name
 }
 
 // GenType 生成类型名称
@@ -57,31 +150,396 @@ func genType(typeName string, isArray bool) string {
 	return typeName
 }
 
+// genManifest 生成全部表格和设置的清单, 按清单加载全部配置数据并关联
+func (gen *CPPGen) genManifest() string {
+	names := gen.cfgMap.GetDataNames()
+	if len(names) == 0 {
+		return ""
+	}
+
+	var buff bytes.Buffer
+	buff.WriteString("//Code generated by game config export tool. DO NOT EDIT.")
+	buff.WriteString("\n#pragma once")
+	buff.WriteString("\n#include <fstream>")
+	buff.WriteString("\n#include <sstream>")
+	buff.WriteString("\n#include <string>")
+	buff.WriteString("\n#include <vector>")
+	for _, name := range names {
+		buff.WriteString("\n#include \"" + name + ".h\"")
+	}
+	buff.WriteString(beginNamespace())
+	buff.WriteString("\n\n//CfgManifest 全部表格和设置的清单")
+	buff.WriteString("\nnamespace CfgManifest")
+	buff.WriteString("\n{")
+	buff.WriteString("\n\t//Names 全部表格和设置的名称")
+	buff.WriteString("\n\tstatic const char *const Names[] = {\"" + strings.Join(names, "\", \"") + "\"};")
+
+	buff.WriteString("\n\n\t//ReadFile 读取文件内容, 文件不存在时返回false")
+	buff.WriteString("\n\tinline bool ReadFile(const std::string &filename, std::string &s)")
+	buff.WriteString("\n\t{")
+	buff.WriteString("\n\t\tstd::ifstream f(filename, std::ios::binary);")
+	buff.WriteString("\n\t\tif (!f)")
+	buff.WriteString("\n\t\t\treturn false;")
+	buff.WriteString("\n\t\tstd::ostringstream ss;")
+	buff.WriteString("\n\t\tss << f.rdbuf();")
+	buff.WriteString("\n\t\ts = ss.str();")
+	buff.WriteString("\n\t\treturn true;")
+	buff.WriteString("\n\t}")
+
+	buff.WriteString("\n\n\t//RelateAll 关联全部表格和设置的父子表, 返回全部找不到的关联")
+	buff.WriteString("\n\tinline std::vector<std::string> RelateAll()")
+	buff.WriteString("\n\t{")
+	buff.WriteString("\n\t\tstd::vector<std::string> errors;")
+	for _, name := range names {
+		buff.WriteString("\n\t\t" + name + ".Relate(\"" + name + "\", errors);")
+	}
+	buff.WriteString("\n\t\treturn errors;")
+	buff.WriteString("\n\t}")
+
+	buff.WriteString("\n\n\t//LoadAll 从目录加载全部表格和设置, 全部解析成功后才替换数据并关联父子表, 返回全部错误, 如: 缺少文件")
+	buff.WriteString("\n\tinline std::vector<std::string> LoadAll(const std::string &dir)")
+	buff.WriteString("\n\t{")
+	buff.WriteString("\n\t\tstd::vector<std::string> errors;")
+	buff.WriteString("\n\t\tstd::string s;")
+	for i, name := range names {
+		data := "data" + strconv.Itoa(i)
+		parse := "::cfg::ParseJSON(s, " + data + ")"
+		if strings.HasSuffix(name, "Settings") {
+			buff.WriteString("\n\t\t" + genStructName(name) + " " + data + "{};")
+		} else {
+			buff.WriteString("\n\t\t::cfg::TableBase<" + genStructName(name) + ">::Data " + data + ";")
+			parse = "::cfg::TableBase<" + genStructName(name) + ">::Parse(s, " + data + ")"
+		}
+		buff.WriteString("\n\t\tif (!ReadFile(dir + \"/" + name + ".json\", s))")
+		buff.WriteString("\n\t\t\terrors.push_back(\"missing file: " + name + ".json\");")
+		buff.WriteString("\n\t\telse if (!" + parse + ")")
+		buff.WriteString("\n\t\t\terrors.push_back(\"parse failed: " + name + ".json\");")
+	}
+	//全部解析成功才替换数据, 不会只替换一部分表格
+	buff.WriteString("\n\t\tif (!errors.empty())")
+	buff.WriteString("\n\t\t\treturn errors;")
+	for i, name := range names {
+		data := "data" + strconv.Itoa(i)
+		if strings.HasSuffix(name, "Settings") {
+			buff.WriteString("\n\t\t" + name + " = std::move(" + data + ");")
+		} else {
+			buff.WriteString("\n\t\t" + name + ".Swap(" + data + ");")
+		}
+	}
+	buff.WriteString("\n\t\treturn RelateAll();")
+	buff.WriteString("\n\t}")
+	buff.WriteString("\n}")
+	buff.WriteString(endNamespace())
+	buff.WriteString("\n")
+	return buff.String()
+}
+
+//收集结构体和联合体(包括嵌套的)中关联的表格, 结构体的头文件只声明关联的表格,
+//由使用结构体的表格和设置在文件末尾包含, 避免结构体和表格的头文件循环包含
+func (gen *CPPGen) collectRelates(name string, visited map[string]bool, relates *[]string) {
+	if visited[name] {
+		return
+	}
+	visited[name] = true
+	if unionDef := gen.cfgMap.UnionMap[name]; unionDef != nil {
+		for i := 0; i < len(unionDef.Items); i++ {
+			if item := unionDef.Items[i]; item.Struct != "" {
+				gen.collectRelates(item.Struct, visited, relates)
+			}
+		}
+		return
+	}
+	tableDef := gen.cfgMap.TableMap[name]
+	if tableDef == nil {
+		return
+	}
+	for i := 0; i < len(tableDef.Fields); i++ {
+		field := tableDef.Fields[i]
+		if field.Name == "" || field.Type == "" ||
+			!(field.IsKey || field.UseFor == "A" || field.UseFor == cfgdef.ExportFlags.UseFor) {
+			continue
+		}
+		if ftable := gen.cfgMap.GetRelateTable(field.FTable); ftable != "" {
+			*relates = append(*relates, ftable)
+		}
+		if field.IsStruct || field.IsUnion {
+			gen.collectRelates(field.Type, visited, relates)
+		}
+	}
+}
+
 // GenFileName 生成文件名
 func (gen *CPPGen) GenFileName(name string) string {
 	return name + ".h"
 }
 
+// GenCommonFiles 生成公共类型定义
+func (gen *CPPGen) GenCommonFiles() map[string]string {
+	files := make(map[string]string)
+	if cfgdef.ExportFlags.CPPRuntime {
+		files["CfgRuntime.h"] = genRuntime(cfgdef.ExportFlags.CPPJSON)
+	}
+	if s := gen.genManifest(); s != "" {
+		files["CfgManifest.h"] = s
+	}
+	var buff2 bytes.Buffer
+	for _, t := range []struct {
+		name   string
+		desc   string
+		fields []string
+	}{
+		{"vec2", "二维向量", []string{"x", "y"}},
+		{"vec3", "三维向量", []string{"x", "y", "z"}},
+		{"color", "颜色, 各分量的取值范围为0~1", []string{"r", "g", "b", "a"}},
+	} {
+		if gen.types[t.name] != "" || !gen.cfgMap.HasFieldType(t.name) {
+			continue
+		}
+		typeName := gen.getValueTypeName(&cfgdef.FieldDef{Type: t.name})
+		buff2.WriteString("\n\n//" + typeName + " " + t.desc)
+		buff2.WriteString("\nstruct " + typeName)
+		buff2.WriteString("\n{")
+		for _, f := range t.fields {
+			buff2.WriteString("\n\tfloat " + f + ";")
+		}
+		buff2.WriteString("\n\n\tbool Parse(const ::cfg::JSONValue &v)")
+		buff2.WriteString("\n\t{")
+		buff2.WriteString("\n\t\tbool ok = true;")
+		for _, f := range t.fields {
+			buff2.WriteString("\n\t\tPARSE_FIELD(" + f + ");")
+		}
+		buff2.WriteString("\n\t\treturn ok;")
+		buff2.WriteString("\n\t}")
+		buff2.WriteString("\n};")
+	}
+	if gen.types["range"] == "" && gen.cfgMap.GetRangeTypes() != nil {
+		buff2.WriteString("\n\n//Range 取值范围")
+		buff2.WriteString("\ntemplate <typename T>")
+		buff2.WriteString("\nstruct Range")
+		buff2.WriteString("\n{")
+		buff2.WriteString("\n\tT min;")
+		buff2.WriteString("\n\tT max;")
+		buff2.WriteString("\n\n\tbool Contains(T v) const { return v >= min && v <= max; }")
+		buff2.WriteString("\n\n\tbool Parse(const ::cfg::JSONValue &v)")
+		buff2.WriteString("\n\t{")
+		buff2.WriteString("\n\t\tbool ok = true;")
+		buff2.WriteString("\n\t\tPARSE_FIELD(min);")
+		buff2.WriteString("\n\t\tPARSE_FIELD(max);")
+		buff2.WriteString("\n\t\treturn ok;")
+		buff2.WriteString("\n\t}")
+		buff2.WriteString("\n};")
+	}
+	if gen.cfgMap.HasFieldType("fixed") {
+		bits := strconv.FormatUint(uint64(cfgdef.ExportFlags.FixedBits), 10)
+		buff2.WriteString("\n\n//Fixed Q" + strconv.FormatUint(uint64(63-cfgdef.ExportFlags.FixedBits), 10) + "." + bits + "定点数, 数据中为原始值")
+		buff2.WriteString("\nstruct Fixed")
+		buff2.WriteString("\n{")
+		buff2.WriteString("\n\tstatic constexpr int FRACTION_BITS = " + bits + ";")
+		buff2.WriteString("\n\tstatic constexpr int64_t ONE = int64_t(1) << FRACTION_BITS;")
+		buff2.WriteString("\n\n\t//raw 原始值")
+		buff2.WriteString("\n\tint64_t raw;")
+		buff2.WriteString("\n\n\tstatic Fixed FromRaw(int64_t v) { return Fixed{v}; }")
+		buff2.WriteString("\n\tstatic Fixed FromInt(int64_t v) { return Fixed{v * ONE}; }")
+		buff2.WriteString("\n\t//ToInt 取整数部分(向下取整)")
+		buff2.WriteString("\n\tint64_t ToInt() const { return raw >> FRACTION_BITS; }")
+		buff2.WriteString("\n\t//ToDouble 转换为浮点数, 仅用于显示, 逻辑计算请使用定点数")
+		buff2.WriteString("\n\tdouble ToDouble() const { return double(raw) / ONE; }")
+		buff2.WriteString("\n\tbool Parse(const ::cfg::JSONValue &v) { return ::cfg::Parse(v, raw); }")
+		buff2.WriteString("\n")
+		buff2.WriteString("\n\tFixed operator+(Fixed v) const { return Fixed{raw + v.raw}; }")
+		buff2.WriteString("\n\tFixed operator-(Fixed v) const { return Fixed{raw - v.raw}; }")
+		buff2.WriteString("\n\tFixed operator-() const { return Fixed{-raw}; }")
+		buff2.WriteString("\n\tFixed operator*(Fixed v) const { return Fixed{MulShift(raw, v.raw)}; }")
+		buff2.WriteString("\n\tFixed operator/(Fixed v) const { return Fixed{DivShift(raw, v.raw)}; }")
+		for _, op := range []string{"==", "!=", "<", ">", "<=", ">="} {
+			buff2.WriteString("\n\tbool operator" + op + "(Fixed v) const { return raw " + op + " v.raw; }")
+		}
+		buff2.WriteString("\n")
+		buff2.WriteString("\n\t//MulShift 使用128位的中间结果计算(a * b) >> FRACTION_BITS, 避免乘法溢出")
+		buff2.WriteString("\n\tstatic int64_t MulShift(int64_t a, int64_t b)")
+		buff2.WriteString("\n\t{")
+		buff2.WriteString("\n#if defined(__SIZEOF_INT128__)")
+		buff2.WriteString("\n\t\t__extension__ typedef __int128 int128;")
+		buff2.WriteString("\n\t\treturn int64_t((int128(a) * b) >> FRACTION_BITS);")
+		buff2.WriteString("\n#else")
+		buff2.WriteString("\n\t\tuint64_t ua = uint64_t(a), ub = uint64_t(b);")
+		buff2.WriteString("\n\t\tuint64_t ll = (ua & 0xFFFFFFFF) * (ub & 0xFFFFFFFF);")
+		buff2.WriteString("\n\t\tuint64_t lh = (ua & 0xFFFFFFFF) * (ub >> 32);")
+		buff2.WriteString("\n\t\tuint64_t hl = (ua >> 32) * (ub & 0xFFFFFFFF);")
+		buff2.WriteString("\n\t\tuint64_t mid = (ll >> 32) + (lh & 0xFFFFFFFF) + (hl & 0xFFFFFFFF);")
+		buff2.WriteString("\n\t\tuint64_t low = (mid << 32) | (ll & 0xFFFFFFFF);")
+		buff2.WriteString("\n\t\tuint64_t high = (ua >> 32) * (ub >> 32) + (lh >> 32) + (hl >> 32) + (mid >> 32);")
+		buff2.WriteString("\n\t\t//无符号的乘积转换为有符号的乘积")
+		buff2.WriteString("\n\t\tif (a < 0)")
+		buff2.WriteString("\n\t\t\thigh -= ub;")
+		buff2.WriteString("\n\t\tif (b < 0)")
+		buff2.WriteString("\n\t\t\thigh -= ua;")
+		buff2.WriteString("\n\t\treturn int64_t((high << (64 - FRACTION_BITS)) | (low >> FRACTION_BITS));")
+		buff2.WriteString("\n#endif")
+		buff2.WriteString("\n\t}")
+		buff2.WriteString("\n")
+		buff2.WriteString("\n\t//DivShift 使用128位的被除数计算(a << FRACTION_BITS) / b, 避免除法溢出, 结果向零取整")
+		buff2.WriteString("\n\tstatic int64_t DivShift(int64_t a, int64_t b)")
+		buff2.WriteString("\n\t{")
+		buff2.WriteString("\n#if defined(__SIZEOF_INT128__)")
+		buff2.WriteString("\n\t\t__extension__ typedef __int128 int128;")
+		buff2.WriteString("\n\t\treturn int64_t((int128(a) * ONE) / b);")
+		buff2.WriteString("\n#else")
+		buff2.WriteString("\n\t\tuint64_t ua = a < 0 ? 0 - uint64_t(a) : uint64_t(a), ub = b < 0 ? 0 - uint64_t(b) : uint64_t(b);")
+		buff2.WriteString("\n\t\tuint64_t low = ua << FRACTION_BITS, rem = (ua >> (64 - FRACTION_BITS)) % ub, q = 0;")
+		buff2.WriteString("\n\t\t//逐位的长除法, 余数始终小于除数, 结果超出范围时和整数运算一样回绕")
+		buff2.WriteString("\n\t\tfor (int i = 63; i >= 0; i--)")
+		buff2.WriteString("\n\t\t{")
+		buff2.WriteString("\n\t\t\tbool carry = (rem >> 63) != 0;")
+		buff2.WriteString("\n\t\t\trem = (rem << 1) | ((low >> i) & 1);")
+		buff2.WriteString("\n\t\t\tq <<= 1;")
+		buff2.WriteString("\n\t\t\tif (carry || rem >= ub)")
+		buff2.WriteString("\n\t\t\t{")
+		buff2.WriteString("\n\t\t\t\trem -= ub;")
+		buff2.WriteString("\n\t\t\t\tq |= 1;")
+		buff2.WriteString("\n\t\t\t}")
+		buff2.WriteString("\n\t\t}")
+		buff2.WriteString("\n\t\treturn (a < 0) != (b < 0) ? int64_t(0 - q) : int64_t(q);")
+		buff2.WriteString("\n#endif")
+		buff2.WriteString("\n\t}")
+		buff2.WriteString("\n};")
+	}
+	if buff2.Len() == 0 {
+		return files
+	}
+
+	var buff bytes.Buffer
+	buff.WriteString("//Code generated by game config export tool. DO NOT EDIT.")
+	buff.WriteString("\n#pragma once")
+	buff.WriteString("\n#include <cstdint>")
+	buff.WriteString("\n#include \"CfgRuntime.h\"")
+	buff.WriteString(beginNamespace())
+	buff.WriteString(buff2.String())
+	buff.WriteString(endNamespace())
+	buff.WriteString("\n")
+	files["CfgTypes.h"] = buff.String()
+	return files
+}
+
 // GenEnum 生成枚举
 func (gen *CPPGen) GenEnum(name string) string {
 	enumDef := gen.cfgMap.EnumMap[name]
 	if enumDef == nil || len(enumDef.Items) == 0 {
-		fmt.Println("error: ", name, "定义无效")
+		cfgdef.Error(name, "定义无效")
 		return ""
 	}
 	var buff bytes.Buffer
 	buff.WriteString("//Code generated by game config export tool. DO NOT EDIT.")
 	buff.WriteString("\n#pragma once")
+	baseType := ""
+	if enumDef.Type != "" {
+		baseType = getTypeName(&cfgdef.FieldDef{Type: enumDef.Type})
+		buff.WriteString("\n#include <cstdint>")
+	}
+	buff.WriteString(beginNamespace())
 	buff.WriteString("\n\n//" + name + " " + enumDef.Desc)
-	buff.WriteString("\nenum " + name)
+	if baseType != "" {
+		buff.WriteString("\nenum class " + name + " : " + baseType)
+	} else {
+		buff.WriteString("\nenum class " + name)
+	}
 	buff.WriteString("\n{")
-	name2 := name[:len(name)-4]
 	for i := 0; i < len(enumDef.Items); i++ {
 		item := enumDef.Items[i]
-		buff.WriteString("\n\t//" + name2 + item.Name + " " + item.Desc)
-		buff.WriteString("\n\t" + name2 + item.Name + " = " + item.Value + ",")
+		buff.WriteString("\n\t//" + item.Name + " " + item.Desc)
+		buff.WriteString("\n\t" + item.Name + " = " + item.Value + ",")
+	}
+	buff.WriteString("\n};")
+	if enumDef.IsFlags && baseType != "" {
+		buff.WriteString("\n")
+		for _, op := range []string{"|", "&", "^"} {
+			buff.WriteString("\ninline " + name + " operator" + op + "(" + name + " a, " + name + " b) { return static_cast<" + name +
+				">(static_cast<" + baseType + ">(a) " + op + " static_cast<" + baseType + ">(b)); }")
+		}
+		buff.WriteString("\ninline " + name + " operator~(" + name + " a) { return static_cast<" + name + ">(~static_cast<" + baseType + ">(a)); }")
+		for _, op := range []string{"|", "&", "^"} {
+			buff.WriteString("\ninline " + name + " &operator" + op + "=(" + name + " &a, " + name + " b) { return a = a " + op + " b; }")
+		}
+		buff.WriteString("\ninline bool HasFlags(" + name + " a, " + name + " b) { return (a & b) == b; }")
 	}
-	buff.WriteString("\n};\n")
+	buff.WriteString(endNamespace())
+	buff.WriteString("\n")
+	return buff.String()
+}
+
+// GenUnion 生成联合体
+func (gen *CPPGen) GenUnion(name string) string {
+	unionDef := gen.cfgMap.UnionMap[name]
+	if unionDef == nil || len(unionDef.Items) == 0 {
+		cfgdef.Error(name, "定义无效")
+		return ""
+	}
+
+	//std::variant的候选类型, 第0个为没有数据时的std::monostate
+	types := []string{"std::monostate"}
+	index := make(map[string]int)
+	for i := 0; i < len(unionDef.Items); i++ {
+		item := unionDef.Items[i]
+		if _, ok := index[item.Struct]; item.Struct != "" && !ok {
+			index[item.Struct] = len(types)
+			types = append(types, item.Struct)
+		}
+	}
+
+	var buff bytes.Buffer
+	buff.WriteString("//Code generated by game config export tool. DO NOT EDIT.")
+	buff.WriteString("\n#pragma once")
+	buff.WriteString("\n#include <variant>")
+	buff.WriteString("\n#include \"CfgRuntime.h\"")
+	buff.WriteString("\n#include \"" + unionDef.Enum + ".h\"")
+	for _, t := range types[1:] {
+		buff.WriteString("\n#include \"" + t + ".h\"")
+	}
+	buff.WriteString(beginNamespace())
+	buff.WriteString("\n\n//" + name + " " + unionDef.Desc)
+	buff.WriteString("\nstruct " + name)
+	buff.WriteString("\n{")
+	buff.WriteString("\n\t//Type 类型")
+	buff.WriteString("\n\t" + unionDef.Enum + " Type;")
+	buff.WriteString("\n\t//Data 数据, 由Type决定")
+	buff.WriteString("\n\tstd::variant<" + strings.Join(types, ", ") + "> Data;")
+	buff.WriteString("\n\n\tbool Parse(const ::cfg::JSONValue &v)")
+	buff.WriteString("\n\t{")
+	buff.WriteString("\n\t\tbool ok = true;")
+	buff.WriteString("\n\t\tPARSE_FIELD(Type);")
+	buff.WriteString("\n\t\tswitch (Type)")
+	buff.WriteString("\n\t\t{")
+	for i := 0; i < len(unionDef.Items); i++ {
+		item := unionDef.Items[i]
+		buff.WriteString("\n\t\tcase " + unionDef.Enum + "::" + item.Name + ":")
+		if item.Struct != "" {
+			buff.WriteString("\n\t\t\tPARSE_VARIANT(Data, " + strconv.Itoa(index[item.Struct]) + ");")
+		} else {
+			buff.WriteString("\n\t\t\tData = std::monostate();")
+		}
+		buff.WriteString("\n\t\t\tbreak;")
+	}
+	buff.WriteString("\n\t\tdefault:")
+	buff.WriteString("\n\t\t\tData = std::monostate();")
+	buff.WriteString("\n\t\t\tbreak;")
+	buff.WriteString("\n\t\t}")
+	buff.WriteString("\n\t\treturn ok;")
+	buff.WriteString("\n\t}")
+	if gen.cfgMap.NeedRelate(name) {
+		//变体的结构体没有包含关联的表格, 使用模板函数在调用时才实例化
+		buff.WriteString("\n\n\ttemplate <typename = void>")
+		buff.WriteString("\n\tvoid Relate(const std::string &path, std::vector<std::string> &errors)")
+		buff.WriteString("\n\t{")
+		buff.WriteString("\n\t\tstd::visit([&](auto &d) { ::cfg::RelateData(d, path, errors); }, Data);")
+		buff.WriteString("\n\t}")
+	} else {
+		buff.WriteString("\n\n\tvoid Relate(const std::string &, std::vector<std::string> &) {}")
+	}
+	buff.WriteString("\n\n\ttemplate <typename T>")
+	buff.WriteString("\n\tconst T *Get() const { return std::get_if<T>(&Data); }")
+	buff.WriteString("\n};")
+	buff.WriteString(endNamespace())
+	buff.WriteString("\n")
 	return buff.String()
 }
 
@@ -89,7 +547,7 @@ func (gen *CPPGen) GenEnum(name string) string {
 func (gen *CPPGen) GenTable(name string) string {
 	tableDef := gen.cfgMap.TableMap[name]
 	if tableDef == nil || len(tableDef.Fields) == 0 {
-		fmt.Println("error: ", name, "定义无效")
+		cfgdef.Error(name, "定义无效")
 		return ""
 	}
 
@@ -101,20 +559,28 @@ func (gen *CPPGen) GenTable(name string) string {
 	var buff2 bytes.Buffer
 	var buff3 bytes.Buffer
 	var buff4 bytes.Buffer
+	var decls bytes.Buffer
+	hasChrono := false
+	hasCfgTypes := false
+	hasCustomTypes := false
 
 	buff.WriteString("//Code generated by game config export tool. DO NOT EDIT.")
 	buff.WriteString("\n#pragma once")
-	buff.WriteString("\n#include <TSingleton.h>")
-	buff.WriteString("\n#include <TableBase.h>")
-	buff.WriteString("\n")
+	buff.WriteString("\n#include \"CfgRuntime.h\"")
+	macro := ""
 	if isSettings {
-		buff.WriteString("\n#define " + name + " TSingleton<" + structName + ">::Instance()")
+		macro = "\n\n#define " + name + " ::cfg::TSingleton<" + qualifiedName(structName) + ">::Instance()"
 	} else if isTable {
-		buff2.WriteString("\nstruct " + structName + ";")
-		buff2.WriteString("\ntypedef const " + structName + " *" + structName + "Ptr;")
-		buff2.WriteString("\n#define " + name + " TableBase<" + structName + ">::Instance()")
+		decls.WriteString("\nstruct " + structName + ";")
+		decls.WriteString("\ntypedef const " + structName + " *" + structName + "Ptr;")
+		macro = "\n\n#define " + name + " ::cfg::TableBase<" + qualifiedName(structName) + ">::Instance()"
 	}
 
+	//结构体、联合体、枚举包含定义的头文件, 关联的表格在命名空间中先声明, 表格和设置在文件末尾包含关联的表格, 可以互相关联
+	included := map[string]bool{name: true}
+	declared := map[string]bool{structName: true}
+	var buff5 bytes.Buffer
+
 	buff2.WriteString("\n\n//" + structName + " " + tableDef.Desc)
 	buff2.WriteString("\nstruct " + structName)
 	buff2.WriteString("\n{")
@@ -124,54 +590,117 @@ func (gen *CPPGen) GenTable(name string) string {
 		if field.Name != "" && field.Type != "" &&
 			(field.IsKey || field.UseFor == "A" || field.UseFor == cfgdef.ExportFlags.UseFor) {
 			typeName := getTypeName(field)
-			if field.IsStruct {
-				buff.WriteString("\nstruct " + typeName + ";")
-			} else if field.IsEnum {
-				buff.WriteString("\nenum " + typeName + ";")
+			isValueType := false
+			if t := gen.getValueTypeName(field); t != "" {
+				typeName = t
+				isValueType = gen.isDefaultValueType(field)
+				if !isValueType && !hasCustomTypes {
+					for _, inc := range gen.includes {
+						buff.WriteString("\n#include <" + inc + ">")
+					}
+					hasCustomTypes = true
+				}
+			}
+			if (isValueType || field.Type == "fixed") && !hasCfgTypes {
+				buff.WriteString("\n#include \"CfgTypes.h\"")
+				hasCfgTypes = true
+			}
+			if (field.Type == "datetime" || field.Type == "duration") && !hasChrono {
+				buff.WriteString("\n#include <chrono>")
+				hasChrono = true
+			}
+			if (field.IsStruct || field.IsUnion || field.IsEnum) && !included[field.Type] {
+				buff.WriteString("\n#include \"" + field.Type + ".h\"")
+				included[field.Type] = true
 			}
 			buff2.WriteString("\n\t//" + field.Name + " " + field.Desc)
 			buff2.WriteString("\n\t" + genType(typeName, field.IsArray) + " " + field.Name + ";")
 			if field.IsArray {
-				if strings.HasSuffix(typeName, "Struct") {
+				if field.IsStruct || field.IsUnion || isValueType {
 					buff3.WriteString("\n\t\tPARSE_STRUCT_ARRAY(" + field.Name + ");")
 				} else {
 					buff3.WriteString("\n\t\tPARSE_ARRAY(" + field.Name + ", " + typeName + ");")
 				}
 			} else {
-				if strings.HasSuffix(typeName, "Struct") {
+				if field.IsStruct || field.IsUnion || isValueType {
 					buff3.WriteString("\n\t\tPARSE_STRUCT(" + field.Name + ");")
 				} else {
 					buff3.WriteString("\n\t\tPARSE_FIELD(" + field.Name + ");")
 				}
 			}
-			if field.FTable != "" {
-				relateName := field.Name + "2" + field.FTable
-				buff2.WriteString("\n\t//" + relateName + " " + field.Name + " --> " + field.FTable)
-				buff2.WriteString("\n\t" + genType(field.FTable+"Struct *", field.IsArray) + " " + relateName + ";")
+			if (field.IsStruct || field.IsUnion) && gen.cfgMap.NeedRelate(field.Type) {
+				if field.IsArray {
+					buff4.WriteString("\n\t\tRELATE_STRUCT_ARRAY(" + field.Name + ");")
+				} else {
+					buff4.WriteString("\n\t\tRELATE_STRUCT(" + field.Name + ");")
+				}
+			}
+			if ftable := gen.cfgMap.GetRelateTable(field.FTable); ftable != "" {
+				relateName := field.Name + "2" + ftable
+				if !declared[ftable+"Struct"] {
+					decls.WriteString("\nstruct " + ftable + "Struct;")
+					declared[ftable+"Struct"] = true
+				}
+				buff2.WriteString("\n\t//" + relateName + " " + field.Name + " --> " + ftable)
 				if field.IsArray {
-					buff4.WriteString("\n\t\tRELATE_ARRAY(" + field.Name + ", " + field.FTable + ");")
+					buff2.WriteString("\n\tstd::vector<const " + ftable + "Struct *> " + relateName + ";")
+					buff4.WriteString("\n\t\tRELATE_ARRAY(" + field.Name + ", " + ftable + ");")
 				} else {
-					buff4.WriteString("\n\t\tRELATE_FIELD(" + field.Name + ", " + field.FTable + ");")
+					buff2.WriteString("\n\tconst " + ftable + "Struct *" + relateName + ";")
+					buff4.WriteString("\n\t\tRELATE_FIELD(" + field.Name + ", " + ftable + ");")
 				}
 			}
 		}
 	}
+	if isTable || isSettings {
+		var relates []string
+		gen.collectRelates(name, make(map[string]bool), &relates)
+		for _, ftable := range relates {
+			if !included[ftable+"Table"] {
+				buff5.WriteString("\n#include \"" + ftable + "Table.h\"")
+				included[ftable+"Table"] = true
+			}
+		}
+	}
 	if isTable {
 		keyField := tableDef.Fields[tableDef.Key]
 		buff2.WriteString("\n\n\ttypedef " + getTypeName(keyField) + " KEY_TYPE;")
-		buff2.WriteString("\n\tKEY_TYPE GetKey() { return this->ID; }")
+		buff2.WriteString("\n\tconst KEY_TYPE &GetKey() const { return this->" + keyField.Name + "; }")
 	}
-	buff2.WriteString("\n\n\tvoid Parse(const JSONValue &v)")
+	buff2.WriteString("\n\n\tbool Parse(const ::cfg::JSONValue &v)")
 	buff2.WriteString("\n\t{")
+	buff2.WriteString("\n\t\tbool ok = true;")
 	buff2.WriteString(buff3.String())
+	buff2.WriteString("\n\t\treturn ok;")
 	buff2.WriteString("\n\t}")
 
-	buff2.WriteString("\n\n\tvoid Relate()")
+	//path为错误信息中的数据位置, 如: ItemTable[1001].Effect
+	if buff4.Len() == 0 {
+		buff2.WriteString("\n\n\tvoid Relate(const std::string &, std::vector<std::string> &)")
+	} else if !isTable && !isSettings {
+		//结构体没有包含关联的表格, 使用模板函数在调用时才实例化
+		buff2.WriteString("\n\n\ttemplate <typename = void>")
+		buff2.WriteString("\n\tvoid Relate(const std::string &path, std::vector<std::string> &errors)")
+	} else {
+		buff2.WriteString("\n\n\tvoid Relate(const std::string &path, std::vector<std::string> &errors)")
+	}
 	buff2.WriteString("\n\t{")
 	buff2.WriteString(buff4.String())
 	buff2.WriteString("\n\t}")
 
+	buff.WriteString(macro)
+	buff.WriteString(beginNamespace())
+	if decls.Len() > 0 {
+		buff.WriteString("\n")
+		buff.WriteString(decls.String())
+	}
 	buff.WriteString(buff2.String())
-	buff.WriteString("\n};\n")
+	buff.WriteString("\n};")
+	buff.WriteString(endNamespace())
+	buff.WriteString("\n")
+	if buff5.Len() > 0 {
+		buff.WriteString(buff5.String())
+		buff.WriteString("\n")
+	}
 	return buff.String()
 }
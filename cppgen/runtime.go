@@ -0,0 +1,444 @@
+package cppgen
+
+import "bytes"
+
+// genRuntime 生成只需要头文件的C++17运行时, JSON库可以通过宏选择, 默认使用cppjson指定的JSON库
+func genRuntime(defaultJSON string) string {
+	var buff bytes.Buffer
+	buff.WriteString("//Code generated by game config export tool. DO NOT EDIT.")
+	buff.WriteString("\n//CfgRuntime 配置数据的C++17运行时, 只需要头文件")
+	buff.WriteString("\n//JSON库在包含此文件前通过宏选择: CFG_JSON_RAPIDJSON 或者 CFG_JSON_NLOHMANN")
+	buff.WriteString("\n#pragma once")
+	buff.WriteString("\n\n#if !defined(CFG_JSON_RAPIDJSON) && !defined(CFG_JSON_NLOHMANN)")
+	if defaultJSON == "nlohmann" {
+		buff.WriteString("\n#define CFG_JSON_NLOHMANN")
+	} else {
+		buff.WriteString("\n#define CFG_JSON_RAPIDJSON")
+	}
+	buff.WriteString("\n#endif")
+	buff.WriteString(runtimeSource)
+	return buff.String()
+}
+
+const runtimeSource = `
+
+#include <chrono>
+#include <cstdint>
+#include <memory>
+#include <string>
+#include <type_traits>
+#include <unordered_map>
+#include <variant>
+#include <vector>
+
+#if defined(CFG_JSON_NLOHMANN)
+#include <nlohmann/json.hpp>
+#else
+#include <rapidjson/document.h>
+#endif
+
+namespace cfg
+{
+#if defined(CFG_JSON_NLOHMANN)
+	//JSONValue JSON值
+	typedef nlohmann::json JSONValue;
+	//JSONDocument JSON文档
+	typedef nlohmann::json JSONDocument;
+
+	inline bool ParseDocument(const std::string &s, JSONDocument &doc)
+	{
+		doc = nlohmann::json::parse(s, nullptr, false);
+		return !doc.is_discarded();
+	}
+
+	inline const JSONValue *FindMember(const JSONValue &v, const char *name)
+	{
+		if (!v.is_object())
+			return nullptr;
+		auto it = v.find(name);
+		return it == v.end() ? nullptr : &*it;
+	}
+
+	inline bool IsNull(const JSONValue &v) { return v.is_null(); }
+	inline bool IsArray(const JSONValue &v) { return v.is_array(); }
+	inline size_t ArraySize(const JSONValue &v) { return v.size(); }
+	inline const JSONValue &ArrayAt(const JSONValue &v, size_t i) { return v[i]; }
+
+	inline bool GetValue(const JSONValue &v, bool &out)
+	{
+		if (!v.is_boolean())
+			return false;
+		out = v.get<bool>();
+		return true;
+	}
+
+	inline bool GetValue(const JSONValue &v, int64_t &out)
+	{
+		if (!v.is_number_integer())
+			return false;
+		out = v.get<int64_t>();
+		return true;
+	}
+
+	inline bool GetValue(const JSONValue &v, uint64_t &out)
+	{
+		if (!v.is_number_unsigned())
+			return false;
+		out = v.get<uint64_t>();
+		return true;
+	}
+
+	inline bool GetValue(const JSONValue &v, double &out)
+	{
+		if (!v.is_number())
+			return false;
+		out = v.get<double>();
+		return true;
+	}
+
+	inline bool GetValue(const JSONValue &v, std::string &out)
+	{
+		if (!v.is_string())
+			return false;
+		out = v.get<std::string>();
+		return true;
+	}
+#else
+	//JSONValue JSON值
+	typedef rapidjson::Value JSONValue;
+	//JSONDocument JSON文档
+	typedef rapidjson::Document JSONDocument;
+
+	inline bool ParseDocument(const std::string &s, JSONDocument &doc)
+	{
+		doc.Parse(s.data(), s.size());
+		return !doc.HasParseError();
+	}
+
+	inline const JSONValue *FindMember(const JSONValue &v, const char *name)
+	{
+		if (!v.IsObject())
+			return nullptr;
+		auto it = v.FindMember(name);
+		return it == v.MemberEnd() ? nullptr : &it->value;
+	}
+
+	inline bool IsNull(const JSONValue &v) { return v.IsNull(); }
+	inline bool IsArray(const JSONValue &v) { return v.IsArray(); }
+	inline size_t ArraySize(const JSONValue &v) { return v.Size(); }
+	inline const JSONValue &ArrayAt(const JSONValue &v, size_t i) { return v[static_cast<rapidjson::SizeType>(i)]; }
+
+	inline bool GetValue(const JSONValue &v, bool &out)
+	{
+		if (!v.IsBool())
+			return false;
+		out = v.GetBool();
+		return true;
+	}
+
+	inline bool GetValue(const JSONValue &v, int64_t &out)
+	{
+		if (!v.IsInt64())
+			return false;
+		out = v.GetInt64();
+		return true;
+	}
+
+	inline bool GetValue(const JSONValue &v, uint64_t &out)
+	{
+		if (!v.IsUint64())
+			return false;
+		out = v.GetUint64();
+		return true;
+	}
+
+	inline bool GetValue(const JSONValue &v, double &out)
+	{
+		if (!v.IsNumber())
+			return false;
+		out = v.GetDouble();
+		return true;
+	}
+
+	inline bool GetValue(const JSONValue &v, std::string &out)
+	{
+		if (!v.IsString())
+			return false;
+		out.assign(v.GetString(), v.GetStringLength());
+		return true;
+	}
+#endif
+
+	//Parser 类型的解析, 默认调用成员函数Parse,
+	//cpptypes指定的自定义值类型需要特化, 如: template <> struct ::cfg::Parser<glm::vec3>
+	template <typename T>
+	struct Parser
+	{
+		static bool Parse(const JSONValue &v, T &out) { return out.Parse(v); }
+	};
+
+	//Parse 解析JSON值, 类型不匹配时返回false
+	template <typename T>
+	inline bool Parse(const JSONValue &v, T &out)
+	{
+		if constexpr (std::is_same_v<T, bool> || std::is_same_v<T, std::string>)
+		{
+			return GetValue(v, out);
+		}
+		else if constexpr (std::is_enum_v<T>)
+		{
+			std::underlying_type_t<T> n;
+			if (!Parse(v, n))
+				return false;
+			out = static_cast<T>(n);
+			return true;
+		}
+		else if constexpr (std::is_integral_v<T>)
+		{
+			std::conditional_t<std::is_signed_v<T>, int64_t, uint64_t> n;
+			if (!GetValue(v, n))
+				return false;
+			out = static_cast<T>(n);
+			return true;
+		}
+		else if constexpr (std::is_floating_point_v<T>)
+		{
+			double d;
+			if (!GetValue(v, d))
+				return false;
+			out = static_cast<T>(d);
+			return true;
+		}
+		else
+		{
+			return Parser<T>::Parse(v, out);
+		}
+	}
+
+	template <typename T>
+	struct Parser<std::vector<T>>
+	{
+		static bool Parse(const JSONValue &v, std::vector<T> &out)
+		{
+			if (!IsArray(v))
+				return false;
+			out.clear();
+			out.resize(ArraySize(v));
+			for (size_t i = 0; i < out.size(); ++i)
+			{
+				if (!cfg::Parse(ArrayAt(v, i), out[i]))
+					return false;
+			}
+			return true;
+		}
+	};
+
+	//datetime 数据中为Unix时间戳(秒)
+	template <>
+	struct Parser<std::chrono::system_clock::time_point>
+	{
+		static bool Parse(const JSONValue &v, std::chrono::system_clock::time_point &out)
+		{
+			int64_t n;
+			if (!GetValue(v, n))
+				return false;
+			out = std::chrono::system_clock::time_point(std::chrono::seconds(n));
+			return true;
+		}
+	};
+
+	//duration 数据中为毫秒
+	template <>
+	struct Parser<std::chrono::milliseconds>
+	{
+		static bool Parse(const JSONValue &v, std::chrono::milliseconds &out)
+		{
+			int64_t n;
+			if (!GetValue(v, n))
+				return false;
+			out = std::chrono::milliseconds(n);
+			return true;
+		}
+	};
+
+	//ParseMember 解析对象的成员, 缺少的成员和null保持默认值
+	template <typename T>
+	inline bool ParseMember(const JSONValue &v, const char *name, T &out)
+	{
+		const JSONValue *m = FindMember(v, name);
+		return m == nullptr || IsNull(*m) || Parse(*m, out);
+	}
+
+	//KeyString 主键转换为字符串, 用于错误信息
+	template <typename K>
+	inline std::string KeyString(const K &key)
+	{
+		if constexpr (std::is_same_v<K, std::string>)
+			return key;
+		else if constexpr (std::is_enum_v<K>)
+			return std::to_string(static_cast<std::underlying_type_t<K>>(key));
+		else
+			return std::to_string(key);
+	}
+
+	//RelateData 关联联合体当前变体的数据, 没有数据时不需要关联
+	inline void RelateData(std::monostate &, const std::string &, std::vector<std::string> &) {}
+
+	template <typename T>
+	inline void RelateData(T &data, const std::string &path, std::vector<std::string> &errors)
+	{
+		data.Relate(path, errors);
+	}
+
+	//TSingleton 单例, 用于设置
+	template <typename T>
+	struct TSingleton
+	{
+		static T &Instance()
+		{
+			static T instance{};
+			return instance;
+		}
+	};
+
+	//TableBase 配置表, 按主键查找, 按表格中的顺序遍历
+	template <typename T>
+	class TableBase
+	{
+	public:
+		typedef typename T::KEY_TYPE KEY_TYPE;
+
+		static TableBase &Instance()
+		{
+			static TableBase instance;
+			return instance;
+		}
+
+		//Data 数据行和主键索引, 可以先解析全部表格, 都成功后再替换
+		struct Data
+		{
+			std::vector<std::unique_ptr<T>> rows;
+			std::unordered_map<KEY_TYPE, T *> index;
+		};
+
+		//Parse 从JSON文本解析数据行, 解析失败或者主键重复时返回false, 不修改已有的数据
+		static bool Parse(const std::string &json, Data &data)
+		{
+			JSONDocument doc;
+			if (!ParseDocument(json, doc) || !IsArray(doc))
+				return false;
+			Data newData;
+			for (size_t i = 0; i < ArraySize(doc); ++i)
+			{
+				auto row = std::make_unique<T>();
+				if (!row->Parse(ArrayAt(doc, i)) || !newData.index.emplace(row->GetKey(), row.get()).second)
+					return false;
+				newData.rows.push_back(std::move(row));
+			}
+			data = std::move(newData);
+			return true;
+		}
+
+		//Swap 替换全部数据行, 替换后需要重新关联全部表格
+		void Swap(Data &data)
+		{
+			rows.swap(data.rows);
+			index.swap(data.index);
+		}
+
+		//Load 从JSON文本加载数据行并替换原有的数据, 解析失败或者主键重复时返回false并保留原有的数据,
+		//替换后需要重新关联全部表格
+		bool Load(const std::string &json)
+		{
+			Data data;
+			if (!Parse(json, data))
+				return false;
+			Swap(data);
+			return true;
+		}
+
+		//Relate 关联全部数据行, 找不到的关联添加到errors, name为错误信息中的表格名称
+		void Relate(const std::string &name, std::vector<std::string> &errors)
+		{
+			for (auto &row : rows)
+				row->Relate(name + "[" + KeyString(row->GetKey()) + "]", errors);
+		}
+
+		//Find 按主键查找数据行, 找不到时返回nullptr
+		const T *Find(const KEY_TYPE &key) const
+		{
+			auto it = index.find(key);
+			return it == index.end() ? nullptr : it->second;
+		}
+
+		//Size 数据行数
+		size_t Size() const { return rows.size(); }
+
+		//Rows 按表格中的顺序返回全部数据行
+		const std::vector<std::unique_ptr<T>> &Rows() const { return rows; }
+
+	private:
+		std::vector<std::unique_ptr<T>> rows;
+		std::unordered_map<KEY_TYPE, T *> index;
+	};
+
+	//Find 在配置表中按主键查找数据行, 用于关联, 找不到时返回nullptr
+	template <typename T, typename K>
+	inline const T *Find(const K &key)
+	{
+		return TableBase<T>::Instance().Find(key);
+	}
+
+	//ParseJSON 从JSON文本解析结构体, 用于设置
+	template <typename T>
+	inline bool ParseJSON(const std::string &json, T &out)
+	{
+		JSONDocument doc;
+		return ParseDocument(json, doc) && out.Parse(doc);
+	}
+
+	//ParseSettings 从JSON文本解析设置, 解析失败时返回false并保留原有的数据
+	template <typename T>
+	inline bool ParseSettings(const std::string &json, T &settings)
+	{
+		T tmp{};
+		if (!ParseJSON(json, tmp))
+			return false;
+		settings = std::move(tmp);
+		return true;
+	}
+}
+
+//生成代码中使用的解析和关联
+#define PARSE_FIELD(f) ok = ::cfg::ParseMember(v, #f, f) && ok
+#define PARSE_ARRAY(f, T) PARSE_FIELD(f)
+#define PARSE_STRUCT(f) PARSE_FIELD(f)
+#define PARSE_STRUCT_ARRAY(f) PARSE_FIELD(f)
+#define PARSE_VARIANT(f, i) ok = ::cfg::ParseMember(v, #f, f.emplace<i>()) && ok
+//关联找不到时添加错误信息, 0和空字符串表示没有关联
+#define RELATE_FIELD(f, T) \
+	do \
+	{ \
+		f##2##T = ::cfg::Find<T##Struct>(f); \
+		if (f##2##T == nullptr && f != decltype(f){}) \
+			errors.push_back(path + "." #f ": can't find " #T " " + ::cfg::KeyString(f)); \
+	} while (0)
+#define RELATE_ARRAY(f, T) \
+	do \
+	{ \
+		f##2##T.assign(f.size(), nullptr); \
+		for (size_t i = 0; i < f.size(); ++i) \
+		{ \
+			f##2##T[i] = ::cfg::Find<T##Struct>(f[i]); \
+			if (f##2##T[i] == nullptr && f[i] != decltype(f)::value_type{}) \
+				errors.push_back(path + "." #f "[" + std::to_string(i) + "]: can't find " #T " " + ::cfg::KeyString(f[i])); \
+		} \
+	} while (0)
+#define RELATE_STRUCT(f) f.Relate(path + "." #f, errors)
+#define RELATE_STRUCT_ARRAY(f) \
+	do \
+	{ \
+		for (size_t i = 0; i < f.size(); ++i) \
+			f[i].Relate(path + "." #f "[" + std::to_string(i) + "]", errors); \
+	} while (0)
+`
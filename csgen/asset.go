@@ -0,0 +1,165 @@
+package csgen
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// EditorDir Unity的Editor脚本相对于生成代码的目录, Unity不会把该目录打包到运行时
+const EditorDir = "Editor"
+
+// genAsset 生成表格或者设置的ScriptableObject资源容器, 资源的类名需要和文件名相同
+func (gen *CSGen) genAsset(name string) string {
+	tableDef := gen.cfgMap.TableMap[name]
+	structName := genStructName(name)
+
+	var buff bytes.Buffer
+	buff.WriteString("// Code generated by game config export tool. DO NOT EDIT.")
+	buff.WriteString("\r\nusing UnityEngine;")
+	buff.WriteString("\r\n\r\nnamespace " + namespace)
+	buff.WriteString("\r\n{")
+	buff.WriteString(genSummary(tableDef.Desc+", 由CfgAssetImporter从JSON数据导入", "\r\n\t"))
+	buff.WriteString("\r\n\tpublic sealed class " + name + "Asset : ScriptableObject")
+	buff.WriteString("\r\n\t{")
+	if strings.HasSuffix(name, "Table") {
+		buff.WriteString(genSummary("按表格中的顺序的全部数据行", "\r\n\t\t"))
+		buff.WriteString("\r\n\t\tpublic " + structName + "[] Rows;")
+		buff.WriteString("\r\n")
+		buff.WriteString(genSummary("替换Facade中的数据, 替换后需要重新关联全部表格", "\r\n\t\t"))
+		buff.WriteString("\r\n\t\tpublic void Apply() { Facade." + name + ".Load(Rows); }")
+	} else {
+		buff.WriteString(genSummary("设置", "\r\n\t\t"))
+		buff.WriteString("\r\n\t\tpublic " + structName + " Data;")
+		buff.WriteString("\r\n")
+		buff.WriteString(genSummary("替换Facade中的数据, 替换后需要重新关联全部表格", "\r\n\t\t"))
+		buff.WriteString("\r\n\t\tpublic void Apply() { Facade." + name + " = Data; }")
+	}
+	buff.WriteString("\r\n\t}")
+	buff.WriteString("\r\n}\r\n")
+	return buff.String()
+}
+
+// genAssetImporter 生成把JSON数据导入为.asset资源的Editor脚本, 已有的资源原地更新, 保持GUID不变
+func (gen *CSGen) genAssetImporter(names []string) string {
+	var buff bytes.Buffer
+	buff.WriteString("// Code generated by game config export tool. DO NOT EDIT.")
+	buff.WriteString("\r\n#if UNITY_EDITOR")
+	buff.WriteString("\r\nusing System;")
+	buff.WriteString("\r\nusing System.Collections.Generic;")
+	buff.WriteString("\r\nusing System.IO;")
+	buff.WriteString("\r\nusing UnityEditor;")
+	buff.WriteString("\r\nusing UnityEngine;")
+	buff.WriteString("\r\n\r\nnamespace " + namespace)
+	buff.WriteString("\r\n{")
+	buff.WriteString(genSummary("把导出的JSON数据导入为ScriptableObject资源, 可以在Inspector中查看, 通过Addressables引用, 导入前需要设置CfgManifest.Parser", "\r\n\t"))
+	buff.WriteString("\r\n\tpublic static class CfgAssetImporter")
+	buff.WriteString("\r\n\t{")
+	buff.WriteString(genSummary("JSON数据目录, 相对于工程目录", "\r\n\t\t"))
+	buff.WriteString("\r\n\t\tpublic static string JsonDir = \"Config/json\";")
+	buff.WriteString(genSummary("资源输出目录", "\r\n\t\t"))
+	buff.WriteString("\r\n\t\tpublic static string AssetDir = \"Assets/" + namespace + "/Data\";")
+	buff.WriteString("\r\n")
+	buff.WriteString("\r\n\t\t[MenuItem(\"Tools/" + namespace + "/Import Assets\")]")
+	buff.WriteString("\r\n\t\tpublic static void ImportAll()")
+	buff.WriteString("\r\n\t\t{")
+	buff.WriteString("\r\n\t\t\tvar errors = ImportAll(JsonDir, AssetDir);")
+	buff.WriteString("\r\n\t\t\tforeach (var e in errors) Debug.LogError(e);")
+	buff.WriteString("\r\n\t\t\tif (errors.Count == 0) Debug.Log(\"" + namespace + ": imported \" + CfgManifest.Names.Length + \" assets to \" + AssetDir);")
+	buff.WriteString("\r\n\t\t}")
+	buff.WriteString("\r\n")
+	buff.WriteString(genSummary("导入全部表格和设置, 全部解析成功后才写入资源, 返回全部错误, 如: 缺少文件", "\r\n\t\t"))
+	buff.WriteString("\r\n\t\tpublic static List<string> ImportAll(string jsonDir, string assetDir)")
+	buff.WriteString("\r\n\t\t{")
+	buff.WriteString("\r\n\t\t\tvar errors = new List<string>();")
+	buff.WriteString("\r\n\t\t\tif (CfgManifest.Parser == null)")
+	buff.WriteString("\r\n\t\t\t{")
+	buff.WriteString("\r\n\t\t\t\terrors.Add(\"CfgManifest.Parser is not set\");")
+	buff.WriteString("\r\n\t\t\t\treturn errors;")
+	buff.WriteString("\r\n\t\t\t}")
+	for i, name := range names {
+		typeName := genStructName(name)
+		if strings.HasSuffix(name, "Table") {
+			typeName += "[]"
+		}
+		buff.WriteString("\r\n\t\t\tvar data" + strconv.Itoa(i) + " = Parse<" + typeName + ">(jsonDir, \"" + name + "\", errors);")
+	}
+	buff.WriteString("\r\n\t\t\tif (errors.Count > 0) return errors;")
+	buff.WriteString("\r\n\t\t\tDirectory.CreateDirectory(assetDir);")
+	for i, name := range names {
+		member := "Data"
+		if strings.HasSuffix(name, "Table") {
+			member = "Rows"
+		}
+		buff.WriteString("\r\n\t\t\tSave<" + name + "Asset>(assetDir, \"" + name + "\", a => a." + member + " = data" + strconv.Itoa(i) + ");")
+	}
+	buff.WriteString("\r\n\t\t\tAssetDatabase.SaveAssets();")
+	buff.WriteString("\r\n\t\t\treturn errors;")
+	buff.WriteString("\r\n\t\t}")
+	buff.WriteString("\r\n")
+	buff.WriteString("\r\n\t\tprivate static T Parse<T>(string jsonDir, string name, List<string> errors) where T : class")
+	buff.WriteString("\r\n\t\t{")
+	buff.WriteString("\r\n\t\t\tstring path = Path.Combine(jsonDir, name + \".json\");")
+	buff.WriteString("\r\n\t\t\tif (!File.Exists(path))")
+	buff.WriteString("\r\n\t\t\t{")
+	buff.WriteString("\r\n\t\t\t\terrors.Add(\"missing file: \" + name + \".json\");")
+	buff.WriteString("\r\n\t\t\t\treturn null;")
+	buff.WriteString("\r\n\t\t\t}")
+	buff.WriteString("\r\n\t\t\ttry")
+	buff.WriteString("\r\n\t\t\t{")
+	buff.WriteString("\r\n\t\t\t\treturn (T)CfgManifest.Parser(typeof(T), File.ReadAllText(path));")
+	buff.WriteString("\r\n\t\t\t}")
+	buff.WriteString("\r\n\t\t\tcatch (Exception e)")
+	buff.WriteString("\r\n\t\t\t{")
+	buff.WriteString("\r\n\t\t\t\terrors.Add(name + \".json: \" + e.Message);")
+	buff.WriteString("\r\n\t\t\t\treturn null;")
+	buff.WriteString("\r\n\t\t\t}")
+	buff.WriteString("\r\n\t\t}")
+	buff.WriteString("\r\n")
+	buff.WriteString(genSummary("已有的资源原地更新, 保持GUID不变, Addressables和其他资源的引用不会失效", "\r\n\t\t"))
+	buff.WriteString("\r\n\t\tprivate static void Save<A>(string assetDir, string name, Action<A> set) where A : ScriptableObject")
+	buff.WriteString("\r\n\t\t{")
+	buff.WriteString("\r\n\t\t\tstring path = assetDir + \"/\" + name + \".asset\";")
+	buff.WriteString("\r\n\t\t\tvar asset = AssetDatabase.LoadAssetAtPath<A>(path);")
+	buff.WriteString("\r\n\t\t\tif (asset == null)")
+	buff.WriteString("\r\n\t\t\t{")
+	buff.WriteString("\r\n\t\t\t\tasset = ScriptableObject.CreateInstance<A>();")
+	buff.WriteString("\r\n\t\t\t\tset(asset);")
+	buff.WriteString("\r\n\t\t\t\tAssetDatabase.CreateAsset(asset, path);")
+	buff.WriteString("\r\n\t\t\t}")
+	buff.WriteString("\r\n\t\t\telse")
+	buff.WriteString("\r\n\t\t\t{")
+	buff.WriteString("\r\n\t\t\t\tset(asset);")
+	buff.WriteString("\r\n\t\t\t\tEditorUtility.SetDirty(asset);")
+	buff.WriteString("\r\n\t\t\t}")
+	buff.WriteString("\r\n\t\t}")
+	buff.WriteString("\r\n\t}")
+	buff.WriteString("\r\n}")
+	buff.WriteString("\r\n#endif\r\n")
+	return buff.String()
+}
+
+// genLoadAssets 生成清单中从资源加载的函数, 资源的加载方式由调用者决定, 如: Resources或者Addressables
+func (gen *CSGen) genLoadAssets(names []string) string {
+	var buff bytes.Buffer
+	buff.WriteString("\r\n")
+	buff.WriteString(genSummary("从ScriptableObject资源加载全部表格和设置并关联父子表, loadAsset按名称返回资源, 返回null表示资源不存在, 如: name => Resources.Load<ScriptableObject>(\"Config/\" + name)", "\r\n\t\t"))
+	buff.WriteString("\r\n\t\tpublic static List<string> LoadAssets(Func<string, UnityEngine.ScriptableObject> loadAsset)")
+	buff.WriteString("\r\n\t\t{")
+	buff.WriteString("\r\n\t\t\tvar errors = new List<string>();")
+	for i, name := range names {
+		asset := "asset" + strconv.Itoa(i)
+		buff.WriteString("\r\n\t\t\tvar " + asset + " = loadAsset(\"" + name + "\") as " + name + "Asset;")
+		buff.WriteString("\r\n\t\t\tif (" + asset + " == null) errors.Add(\"missing asset: " + name + "\");")
+		if strings.HasSuffix(name, "Table") {
+			buff.WriteString("\r\n\t\t\telse " + gen.checkKeys(name, asset+".Rows", name))
+		}
+	}
+	buff.WriteString("\r\n\t\t\tif (errors.Count > 0) return errors;")
+	for i := range names {
+		buff.WriteString("\r\n\t\t\tasset" + strconv.Itoa(i) + ".Apply();")
+	}
+	buff.WriteString("\r\n\t\t\treturn RelateAll();")
+	buff.WriteString("\r\n\t\t}")
+	return buff.String()
+}
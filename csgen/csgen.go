@@ -2,7 +2,8 @@ package csgen
 
 import (
 	"bytes"
-	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/gamewheels/cfgwheel/cfgdef"
@@ -10,15 +11,62 @@ import (
 
 var namespace = "GameConfig"
 
+// Options C#胶水代码的生成选项, Unity客户端和.NET服务端使用相同的选项时生成的代码源码兼容
+type Options struct {
+	// Unity 向量和颜色使用UnityEngine的类型, 可以生成ScriptableObject资源
+	Unity bool
+	// Serializable 使用[Serializable]按字段名序列化, 如: JsonUtility, 否则使用[DataContract]
+	Serializable bool
+	// Fields 数据使用公开字段, 需要转换的字段在同名字段中保留原始值, 转换后的值通过XxxValue访问, 否则使用只读属性
+	Fields bool
+	// EnumPrefix 枚举项使用枚举名去掉Enum或者Flags后缀作为前缀, 如: ItemTypeEquip
+	EnumPrefix bool
+	// Net 使用.NET 6以上的System.Text.Json源生成加载, 生成record, 忽略Serializable和Fields
+	Net bool
+}
+
+// DefaultOptions 按导出参数获得C#胶水代码的生成选项, 默认使用[DataContract]、只读属性和带前缀的枚举项,
+// 使用-csunity时和Unity胶水代码的默认选项相同
+func DefaultOptions() Options {
+	if cfgdef.ExportFlags.CSUnity {
+		options := UnityOptions()
+		options.Unity = false
+		return options
+	}
+	return Options{
+		Serializable: cfgdef.ExportFlags.CSAttr == "serializable",
+		Fields:       cfgdef.ExportFlags.CSFields,
+		EnumPrefix:   cfgdef.ExportFlags.CSEnum != "plain",
+		Net:          cfgdef.ExportFlags.CSNet,
+	}
+}
+
+// UnityOptions 获得Unity胶水代码的生成选项, 使用JsonUtility可以序列化的公开字段, 枚举项默认不加前缀
+func UnityOptions() Options {
+	return Options{
+		Unity:        true,
+		Serializable: true,
+		Fields:       true,
+		EnumPrefix:   cfgdef.ExportFlags.CSEnum == "prefix",
+	}
+}
+
 // CSGen C#胶水代码生成器
 type CSGen struct {
 	cfgMap *cfgdef.CfgMap
+	opts   Options
 }
 
 // NewCSGen 构建C#胶水代码生成器
 func NewCSGen(cfgMap *cfgdef.CfgMap) *CSGen {
+	return NewCSGenWithOptions(cfgMap, DefaultOptions())
+}
+
+// NewCSGenWithOptions 按生成选项构建C#胶水代码生成器
+func NewCSGenWithOptions(cfgMap *cfgdef.CfgMap, opts Options) *CSGen {
 	return &CSGen{
 		cfgMap: cfgMap,
+		opts:   opts,
 	}
 }
 
@@ -37,10 +85,20 @@ func genStructName(name string) string {
 	return name
 }
 
-func getTypeName(field *cfgdef.FieldDef) string {
-	if field.IsEnum || field.IsStruct {
+func (gen *CSGen) getTypeName(field *cfgdef.FieldDef) string {
+	if field.IsEnum || field.IsStruct || field.IsUnion {
 		return field.Type
 	}
+	if gen.opts.Unity {
+		switch field.Type {
+		case "vec2":
+			return "UnityEngine.Vector2"
+		case "vec3":
+			return "UnityEngine.Vector3"
+		case "color":
+			return "UnityEngine.Color"
+		}
+	}
 	switch field.Type {
 	case "float32":
 		return "float"
@@ -62,10 +120,40 @@ func getTypeName(field *cfgdef.FieldDef) string {
 		return "uint"
 	case "uint64":
 		return "ulong"
+	case "datetime":
+		return "System.DateTime"
+	case "duration":
+		return "System.TimeSpan"
+	case "fixed":
+		return "Fixed"
+	case "text":
+		return "string"
+	case "vec2":
+		return "Vec2"
+	case "vec3":
+		return "Vec3"
+	case "color":
+		return "Color"
+	}
+	if elemType := cfgdef.GetRangeType(field.Type); elemType != "" {
+		return "Range<" + gen.getTypeName(&cfgdef.FieldDef{Type: elemType}) + ">"
 	}
 	return field.Type
 }
 
+// getRawType 获得数据中需要转换的字段的原始类型及转换函数, 如: datetime在数据中为Unix秒
+func getRawType(field *cfgdef.FieldDef) (string, string) {
+	switch field.Type {
+	case "datetime":
+		return "long", "ToDateTime"
+	case "duration":
+		return "long", "ToTimeSpan"
+	case "fixed":
+		return "long", "ToFixed"
+	}
+	return "", ""
+}
+
 // GenType 生成类型名称
 func genType(typeName string, isArray bool) string {
 	if isArray {
@@ -74,16 +162,453 @@ func genType(typeName string, isArray bool) string {
 	return typeName
 }
 
+// enumItemName 按命名策略获得枚举项的名称
+func (gen *CSGen) enumItemName(enumName string, item string) string {
+	if gen.opts.EnumPrefix {
+		return cfgdef.GetEnumBaseName(enumName) + item
+	}
+	return item
+}
+
+// typeAttr 获得数据类型的序列化特性
+func (gen *CSGen) typeAttr() string {
+	if gen.opts.Serializable {
+		return "\r\n\t[Serializable]"
+	}
+	return "\r\n\t[DataContract]"
+}
+
+// usingAttr 获得序列化特性需要的命名空间
+func (gen *CSGen) usingAttr() string {
+	if gen.opts.Serializable {
+		return "\r\nusing System;"
+	}
+	return "\r\nusing System.Runtime.Serialization;"
+}
+
+// genMember 生成数据成员, 公开字段或者只读属性
+func (gen *CSGen) genMember(typeName string, name string) string {
+	attr := ""
+	if !gen.opts.Serializable {
+		attr = "\r\n\t\t[DataMember]"
+	}
+	if gen.opts.Fields {
+		return attr + "\r\n\t\tpublic " + typeName + " " + name + ";"
+	}
+	return attr + "\r\n\t\tpublic " + typeName + " " + name + " { get; private set; }"
+}
+
 // GenFileName 生成文件名
 func (gen *CSGen) GenFileName(name string) string {
 	return name + ".cs"
 }
 
+// GenCommonFiles 生成公共类型定义
+func (gen *CSGen) GenCommonFiles() map[string]string {
+	files := make(map[string]string)
+	if s := gen.genManifest(); s != "" {
+		files["CfgManifest.cs"] = s
+	}
+	if gen.opts.Unity && cfgdef.ExportFlags.UAsset {
+		names := gen.cfgMap.GetDataNames()
+		for _, name := range names {
+			files[name+"Asset.cs"] = gen.genAsset(name)
+		}
+		if len(names) > 0 {
+			files[EditorDir+"/CfgAssetImporter.cs"] = gen.genAssetImporter(names)
+		}
+	}
+	if gen.opts.Net {
+		files["CfgRuntime.cs"] = genNetRuntime()
+		if s := gen.genNetContext(); s != "" {
+			files["CfgJsonContext.cs"] = s
+		}
+	}
+	hasDateTime := gen.cfgMap.HasFieldType("datetime")
+	hasDuration := gen.cfgMap.HasFieldType("duration")
+	hasFixed := gen.cfgMap.HasFieldType("fixed")
+
+	//.NET模式通过JSON转换器转换, 值类型的字段需要JsonInclude, Serializable按字段名序列化, 字段名和数据中的名称相同
+	typeAttr := "\r\n\t[DataContract]"
+	memberAttr := func(name string) string { return "\r\n\t\t[DataMember(Name = \"" + name + "\")]" }
+	memberName := strings.ToUpper
+	if gen.opts.Net {
+		typeAttr = ""
+		memberAttr = func(name string) string { return "\r\n\t\t[JsonInclude, JsonPropertyName(\"" + name + "\")]" }
+	} else if gen.opts.Serializable {
+		typeAttr = "\r\n\t[Serializable]"
+		memberAttr = func(name string) string { return "" }
+		memberName = func(name string) string { return name }
+	}
+
+	var buff2 bytes.Buffer
+	if (hasDateTime || hasDuration || hasFixed) && !gen.opts.Net {
+		buff2.WriteString(genSummary("配置数据类型转换", "\r\n\t"))
+		buff2.WriteString("\r\n\tpublic static class CfgConvert")
+		buff2.WriteString("\r\n\t{")
+		if hasDateTime {
+			buff2.WriteString(genSummary("Unix时间戳(秒)转换为UTC时间", "\r\n\t\t"))
+			buff2.WriteString("\r\n\t\tpublic static DateTime ToDateTime(long v) { return DateTimeOffset.FromUnixTimeSeconds(v).UtcDateTime; }")
+			buff2.WriteString("\r\n\t\tpublic static DateTime[] ToDateTime(long[] v) { return v == null ? null : Array.ConvertAll(v, x => ToDateTime(x)); }")
+		}
+		if hasDuration {
+			buff2.WriteString(genSummary("毫秒转换为时长", "\r\n\t\t"))
+			buff2.WriteString("\r\n\t\tpublic static TimeSpan ToTimeSpan(long v) { return TimeSpan.FromMilliseconds(v); }")
+			buff2.WriteString("\r\n\t\tpublic static TimeSpan[] ToTimeSpan(long[] v) { return v == null ? null : Array.ConvertAll(v, x => ToTimeSpan(x)); }")
+		}
+		if hasFixed {
+			buff2.WriteString(genSummary("原始值转换为定点数", "\r\n\t\t"))
+			buff2.WriteString("\r\n\t\tpublic static Fixed ToFixed(long v) { return Fixed.FromRaw(v); }")
+			buff2.WriteString("\r\n\t\tpublic static Fixed[] ToFixed(long[] v) { return v == null ? null : Array.ConvertAll(v, x => ToFixed(x)); }")
+		}
+		buff2.WriteString("\r\n\t}")
+	}
+	if hasFixed {
+		bits := strconv.FormatUint(uint64(cfgdef.ExportFlags.FixedBits), 10)
+		buff2.WriteString("\r\n")
+		buff2.WriteString(genSummary("Q"+strconv.FormatUint(uint64(63-cfgdef.ExportFlags.FixedBits), 10)+"."+bits+"定点数", "\r\n\t"))
+		if gen.opts.Net {
+			buff2.WriteString("\r\n\t[JsonConverter(typeof(FixedJsonConverter))]")
+		}
+		buff2.WriteString("\r\n\tpublic struct Fixed : IEquatable<Fixed>, IComparable<Fixed>")
+		buff2.WriteString("\r\n\t{")
+		buff2.WriteString("\r\n\t\tpublic const int FractionBits = " + bits + ";")
+		buff2.WriteString("\r\n\t\tpublic const long One = 1L << FractionBits;")
+		buff2.WriteString("\r\n")
+		buff2.WriteString(genSummary("原始值", "\r\n\t\t"))
+		buff2.WriteString("\r\n\t\tpublic long Raw;")
+		buff2.WriteString("\r\n")
+		buff2.WriteString("\r\n\t\tpublic static Fixed FromRaw(long raw) { return new Fixed { Raw = raw }; }")
+		buff2.WriteString("\r\n\t\tpublic static Fixed FromInt(long v) { return new Fixed { Raw = v << FractionBits }; }")
+		buff2.WriteString("\r\n")
+		buff2.WriteString(genSummary("取整数部分(向下取整)", "\r\n\t\t"))
+		buff2.WriteString("\r\n\t\tpublic long ToInt() { return Raw >> FractionBits; }")
+		buff2.WriteString(genSummary("转换为浮点数, 仅用于显示, 逻辑计算请使用定点数", "\r\n\t\t"))
+		buff2.WriteString("\r\n\t\tpublic double ToDouble() { return (double)Raw / One; }")
+		buff2.WriteString("\r\n")
+		buff2.WriteString("\r\n\t\tpublic static Fixed operator +(Fixed a, Fixed b) { return FromRaw(a.Raw + b.Raw); }")
+		buff2.WriteString("\r\n\t\tpublic static Fixed operator -(Fixed a, Fixed b) { return FromRaw(a.Raw - b.Raw); }")
+		buff2.WriteString("\r\n\t\tpublic static Fixed operator -(Fixed a) { return FromRaw(-a.Raw); }")
+		buff2.WriteString("\r\n\t\tpublic static Fixed operator *(Fixed a, Fixed b) { return FromRaw(MulShift(a.Raw, b.Raw)); }")
+		buff2.WriteString("\r\n\t\tpublic static Fixed operator /(Fixed a, Fixed b) { return FromRaw(DivShift(a.Raw, b.Raw)); }")
+		for _, op := range []string{"==", "!=", "<", ">", "<=", ">="} {
+			buff2.WriteString("\r\n\t\tpublic static bool operator " + op + "(Fixed a, Fixed b) { return a.Raw " + op + " b.Raw; }")
+		}
+		buff2.WriteString("\r\n")
+		buff2.WriteString(genSummary("使用128位的中间结果计算(a * b) >> FractionBits, 避免乘法溢出", "\r\n\t\t"))
+		buff2.WriteString("\r\n\t\tprivate static long MulShift(long a, long b)")
+		buff2.WriteString("\r\n\t\t{")
+		buff2.WriteString("\r\n#if NET5_0_OR_GREATER")
+		buff2.WriteString("\r\n\t\t\tlong high = Math.BigMul(a, b, out long low);")
+		buff2.WriteString("\r\n\t\t\treturn (high << (64 - FractionBits)) | (long)((ulong)low >> FractionBits);")
+		buff2.WriteString("\r\n#else")
+		buff2.WriteString("\r\n\t\t\tulong ua = (ulong)a, ub = (ulong)b;")
+		buff2.WriteString("\r\n\t\t\tulong ll = (ua & 0xFFFFFFFF) * (ub & 0xFFFFFFFF);")
+		buff2.WriteString("\r\n\t\t\tulong lh = (ua & 0xFFFFFFFF) * (ub >> 32);")
+		buff2.WriteString("\r\n\t\t\tulong hl = (ua >> 32) * (ub & 0xFFFFFFFF);")
+		buff2.WriteString("\r\n\t\t\tulong mid = (ll >> 32) + (lh & 0xFFFFFFFF) + (hl & 0xFFFFFFFF);")
+		buff2.WriteString("\r\n\t\t\tulong low = (mid << 32) | (ll & 0xFFFFFFFF);")
+		buff2.WriteString("\r\n\t\t\tulong high = (ua >> 32) * (ub >> 32) + (lh >> 32) + (hl >> 32) + (mid >> 32);")
+		buff2.WriteString("\r\n\t\t\t//无符号的乘积转换为有符号的乘积")
+		buff2.WriteString("\r\n\t\t\tif (a < 0) high -= ub;")
+		buff2.WriteString("\r\n\t\t\tif (b < 0) high -= ua;")
+		buff2.WriteString("\r\n\t\t\treturn (long)((high << (64 - FractionBits)) | (low >> FractionBits));")
+		buff2.WriteString("\r\n#endif")
+		buff2.WriteString("\r\n\t\t}")
+		buff2.WriteString("\r\n")
+		buff2.WriteString(genSummary("使用128位的被除数计算(a << FractionBits) / b, 避免除法溢出, 结果向零取整", "\r\n\t\t"))
+		buff2.WriteString("\r\n\t\tprivate static long DivShift(long a, long b)")
+		buff2.WriteString("\r\n\t\t{")
+		buff2.WriteString("\r\n#if NET7_0_OR_GREATER")
+		buff2.WriteString("\r\n\t\t\treturn (long)(((Int128)a << FractionBits) / b);")
+		buff2.WriteString("\r\n#else")
+		buff2.WriteString("\r\n\t\t\tulong ua = a < 0 ? 0 - (ulong)a : (ulong)a, ub = b < 0 ? 0 - (ulong)b : (ulong)b;")
+		buff2.WriteString("\r\n\t\t\tulong low = ua << FractionBits, rem = (ua >> (64 - FractionBits)) % ub, q = 0;")
+		buff2.WriteString("\r\n\t\t\t//逐位的长除法, 余数始终小于除数, 结果超出范围时和整数运算一样回绕")
+		buff2.WriteString("\r\n\t\t\tfor (int i = 63; i >= 0; i--)")
+		buff2.WriteString("\r\n\t\t\t{")
+		buff2.WriteString("\r\n\t\t\t\tbool carry = (rem >> 63) != 0;")
+		buff2.WriteString("\r\n\t\t\t\trem = (rem << 1) | ((low >> i) & 1);")
+		buff2.WriteString("\r\n\t\t\t\tq <<= 1;")
+		buff2.WriteString("\r\n\t\t\t\tif (carry || rem >= ub)")
+		buff2.WriteString("\r\n\t\t\t\t{")
+		buff2.WriteString("\r\n\t\t\t\t\trem -= ub;")
+		buff2.WriteString("\r\n\t\t\t\t\tq |= 1;")
+		buff2.WriteString("\r\n\t\t\t\t}")
+		buff2.WriteString("\r\n\t\t\t}")
+		buff2.WriteString("\r\n\t\t\treturn (a < 0) != (b < 0) ? (long)(0 - q) : (long)q;")
+		buff2.WriteString("\r\n#endif")
+		buff2.WriteString("\r\n\t\t}")
+		buff2.WriteString("\r\n")
+		buff2.WriteString("\r\n\t\tpublic bool Equals(Fixed other) { return Raw == other.Raw; }")
+		buff2.WriteString("\r\n\t\tpublic override bool Equals(object obj) { return obj is Fixed && Equals((Fixed)obj); }")
+		buff2.WriteString("\r\n\t\tpublic override int GetHashCode() { return Raw.GetHashCode(); }")
+		buff2.WriteString("\r\n\t\tpublic int CompareTo(Fixed other) { return Raw.CompareTo(other.Raw); }")
+		buff2.WriteString("\r\n\t\tpublic override string ToString() { return ToDouble().ToString(System.Globalization.CultureInfo.InvariantCulture); }")
+		buff2.WriteString("\r\n\t}")
+		if gen.opts.Net {
+			buff2.WriteString("\r\n")
+			buff2.WriteString(genSummary("定点数在数据中为原始值", "\r\n\t"))
+			buff2.WriteString("\r\n\tpublic sealed class FixedJsonConverter : JsonConverter<Fixed>")
+			buff2.WriteString("\r\n\t{")
+			buff2.WriteString("\r\n\t\tpublic override Fixed Read(ref Utf8JsonReader reader, Type typeToConvert, JsonSerializerOptions options) => Fixed.FromRaw(reader.GetInt64());")
+			buff2.WriteString("\r\n")
+			buff2.WriteString("\r\n\t\tpublic override void Write(Utf8JsonWriter writer, Fixed value, JsonSerializerOptions options) => writer.WriteNumberValue(value.Raw);")
+			buff2.WriteString("\r\n\t}")
+		}
+	}
+	for _, t := range []struct {
+		name   string
+		desc   string
+		fields []string
+	}{
+		{"Vec2", "二维向量", []string{"x", "y"}},
+		{"Vec3", "三维向量", []string{"x", "y", "z"}},
+		{"Color", "颜色, 各分量的取值范围为0~1", []string{"r", "g", "b", "a"}},
+	} {
+		if gen.opts.Unity || !gen.cfgMap.HasFieldType(strings.ToLower(t.name)) {
+			continue
+		}
+		buff2.WriteString("\r\n")
+		buff2.WriteString(genSummary(t.desc, "\r\n\t"))
+		buff2.WriteString(typeAttr)
+		buff2.WriteString("\r\n\tpublic struct " + t.name)
+		buff2.WriteString("\r\n\t{")
+		for _, f := range t.fields {
+			buff2.WriteString(memberAttr(f))
+			buff2.WriteString("\r\n\t\tpublic float " + memberName(f) + ";")
+		}
+		buff2.WriteString("\r\n\t}")
+	}
+	if gen.cfgMap.GetRangeTypes() != nil {
+		buff2.WriteString("\r\n")
+		buff2.WriteString(genSummary("取值范围", "\r\n\t"))
+		buff2.WriteString(typeAttr)
+		buff2.WriteString("\r\n\tpublic struct Range<T> where T : IComparable<T>")
+		buff2.WriteString("\r\n\t{")
+		minName, maxName := "Min", "Max"
+		if gen.opts.Serializable && !gen.opts.Net {
+			minName, maxName = "min", "max"
+		}
+		buff2.WriteString(memberAttr("min"))
+		buff2.WriteString("\r\n\t\tpublic T " + minName + ";")
+		buff2.WriteString(memberAttr("max"))
+		buff2.WriteString("\r\n\t\tpublic T " + maxName + ";")
+		buff2.WriteString("\r\n")
+		buff2.WriteString(genSummary("是否在取值范围内", "\r\n\t\t"))
+		buff2.WriteString("\r\n\t\tpublic bool Contains(T v) { return v.CompareTo(" + minName + ") >= 0 && v.CompareTo(" + maxName + ") <= 0; }")
+		buff2.WriteString("\r\n\t}")
+	}
+	if cfgdef.ExportFlags.BackRefs {
+		buff2.WriteString(genSummary("外键引用, Row为引用方的数据行", "\r\n\t"))
+		buff2.WriteString("\r\n\tpublic struct CfgRef")
+		buff2.WriteString("\r\n\t{")
+		buff2.WriteString("\r\n\t\tpublic readonly string Table;")
+		buff2.WriteString("\r\n\t\tpublic readonly string Field;")
+		buff2.WriteString("\r\n\t\tpublic readonly object Row;")
+		buff2.WriteString("\r\n\r\n\t\tpublic CfgRef(string table, string field, object row)")
+		buff2.WriteString("\r\n\t\t{")
+		buff2.WriteString("\r\n\t\t\tTable = table;")
+		buff2.WriteString("\r\n\t\t\tField = field;")
+		buff2.WriteString("\r\n\t\t\tRow = row;")
+		buff2.WriteString("\r\n\t\t}")
+		buff2.WriteString("\r\n\t}")
+	}
+	if buff2.Len() == 0 {
+		return files
+	}
+
+	var buff bytes.Buffer
+	buff.WriteString("// Code generated by game config export tool. DO NOT EDIT.")
+	if gen.opts.Net {
+		buff.WriteString("\r\n#nullable disable")
+	}
+	buff.WriteString("\r\nusing System;")
+	if gen.opts.Net {
+		buff.WriteString("\r\nusing System.Text.Json;")
+		buff.WriteString("\r\nusing System.Text.Json.Serialization;")
+	} else if !gen.opts.Serializable {
+		buff.WriteString("\r\nusing System.Runtime.Serialization;")
+	}
+	buff.WriteString("\r\n\r\nnamespace " + namespace)
+	buff.WriteString("\r\n{")
+	buff.WriteString(buff2.String())
+	buff.WriteString("\r\n}\r\n")
+	files["CfgTypes.cs"] = buff.String()
+	return files
+}
+
+// genManifest 生成全部表格和设置的清单, 按清单加载全部配置数据并关联
+func (gen *CSGen) genManifest() string {
+	names := gen.cfgMap.GetDataNames()
+	if len(names) == 0 {
+		return ""
+	}
+
+	var buff bytes.Buffer
+	buff.WriteString("// Code generated by game config export tool. DO NOT EDIT.")
+	if gen.opts.Net {
+		buff.WriteString("\r\n#nullable disable")
+	}
+	buff.WriteString("\r\nusing System;")
+	buff.WriteString("\r\nusing System.Collections.Generic;")
+	buff.WriteString("\r\nusing System.IO;")
+	if gen.opts.Net {
+		buff.WriteString("\r\nusing System.Text.Json;")
+	}
+	buff.WriteString("\r\n\r\nnamespace " + namespace)
+	buff.WriteString("\r\n{")
+	if gen.opts.Net {
+		buff.WriteString(genSummary("全部表格和设置的清单", "\r\n\t"))
+	} else {
+		buff.WriteString(genSummary("全部表格和设置的清单, 需要运行时的DataTable提供Load(V[] rows)和Values", "\r\n\t"))
+	}
+	buff.WriteString("\r\n\tpublic static class CfgManifest")
+	buff.WriteString("\r\n\t{")
+	buff.WriteString(genSummary("全部表格和设置的名称", "\r\n\t\t"))
+	buff.WriteString("\r\n\t\tpublic static readonly string[] Names = { \"" + strings.Join(names, "\", \"") + "\" };")
+	buff.WriteString("\r\n")
+	if gen.opts.Net {
+		buff.WriteString(genSummary("JSON解析, 参数为目标类型和JSON文本, 表格的目标类型为数据行数组, 默认使用源生成的CfgJsonContext", "\r\n\t\t"))
+		buff.WriteString("\r\n\t\tpublic static Func<Type, string, object> Parser = (type, text) => JsonSerializer.Deserialize(text, type, CfgJsonContext.Configured);")
+	} else {
+		buff.WriteString(genSummary("JSON解析, 参数为目标类型和JSON文本, 表格的目标类型为数据行数组, 加载前需要设置", "\r\n\t\t"))
+		buff.WriteString("\r\n\t\tpublic static Func<Type, string, object> Parser;")
+	}
+	buff.WriteString("\r\n")
+	buff.WriteString(genSummary("从目录加载全部表格和设置, 全部解析成功并且主键没有重复时才替换数据并关联父子表, 返回全部错误, 如: 缺少文件", "\r\n\t\t"))
+	buff.WriteString("\r\n\t\tpublic static List<string> LoadAll(string dir)")
+	buff.WriteString("\r\n\t\t{")
+	buff.WriteString("\r\n\t\t\treturn LoadAll(name =>")
+	buff.WriteString("\r\n\t\t\t{")
+	buff.WriteString("\r\n\t\t\t\tstring path = Path.Combine(dir, name + \".json\");")
+	buff.WriteString("\r\n\t\t\t\treturn File.Exists(path) ? File.ReadAllText(path) : null;")
+	buff.WriteString("\r\n\t\t\t});")
+	buff.WriteString("\r\n\t\t}")
+	buff.WriteString("\r\n")
+	buff.WriteString(genSummary("按名称读取JSON文本加载全部表格和设置, readText返回null表示文件不存在", "\r\n\t\t"))
+	buff.WriteString("\r\n\t\tpublic static List<string> LoadAll(Func<string, string> readText)")
+	buff.WriteString("\r\n\t\t{")
+	buff.WriteString("\r\n\t\t\tvar errors = new List<string>();")
+	buff.WriteString("\r\n\t\t\tif (Parser == null)")
+	buff.WriteString("\r\n\t\t\t{")
+	buff.WriteString("\r\n\t\t\t\terrors.Add(\"CfgManifest.Parser is not set\");")
+	buff.WriteString("\r\n\t\t\t\treturn errors;")
+	buff.WriteString("\r\n\t\t\t}")
+	for i, name := range names {
+		typeName := genStructName(name)
+		if strings.HasSuffix(name, "Table") {
+			typeName += "[]"
+		}
+		buff.WriteString("\r\n\t\t\tvar data" + strconv.Itoa(i) + " = Parse<" + typeName + ">(\"" + name + "\", readText, errors);")
+		if strings.HasSuffix(name, "Table") {
+			buff.WriteString("\r\n\t\t\tif (data" + strconv.Itoa(i) + " != null) " + gen.checkKeys(name, "data"+strconv.Itoa(i), name+".json"))
+		}
+	}
+	//全部解析成功并且主键没有重复时才替换数据, 不会只替换一部分表格
+	buff.WriteString("\r\n\t\t\tif (errors.Count > 0) return errors;")
+	for i, name := range names {
+		if strings.HasSuffix(name, "Table") {
+			buff.WriteString("\r\n\t\t\tFacade." + name + ".Load(data" + strconv.Itoa(i) + ");")
+		} else {
+			buff.WriteString("\r\n\t\t\tFacade." + name + " = data" + strconv.Itoa(i) + ";")
+		}
+	}
+	buff.WriteString("\r\n\t\t\treturn RelateAll();")
+	buff.WriteString("\r\n\t\t}")
+	if gen.opts.Unity && cfgdef.ExportFlags.UAsset {
+		buff.WriteString(gen.genLoadAssets(names))
+	}
+	buff.WriteString("\r\n")
+	buff.WriteString(genSummary("关联全部表格和设置的父子表, 返回全部错误", "\r\n\t\t"))
+	buff.WriteString("\r\n\t\tpublic static List<string> RelateAll()")
+	buff.WriteString("\r\n\t\t{")
+	if cfgdef.ExportFlags.BackRefs {
+		//重新关联时先清除反向引用, 避免重复收集
+		for _, name := range names {
+			if strings.HasSuffix(name, "Table") && gen.cfgMap.IsReferenced(name) {
+				buff.WriteString("\r\n\t\t\tforeach (var row in Facade." + name + ".Values) row.ClearReferences();")
+			}
+		}
+	}
+	buff.WriteString("\r\n\t\t\tvar errors = new List<string>();")
+	for _, name := range names {
+		switch {
+		case gen.opts.Net && strings.HasSuffix(name, "Table"):
+			buff.WriteString("\r\n\t\t\tforeach (var row in Facade." + name + ".Values) row.Relate(errors);")
+		case gen.opts.Net:
+			buff.WriteString("\r\n\t\t\tFacade." + name + "?.Relate(errors);")
+		case strings.HasSuffix(name, "Table"):
+			buff.WriteString("\r\n\t\t\tforeach (var row in Facade." + name + ".Values) Relate(\"" + name + "\", row.Relate, errors);")
+		default:
+			buff.WriteString("\r\n\t\t\tif (Facade." + name + " != null) Relate(\"" + name + "\", Facade." + name + ".Relate, errors);")
+		}
+	}
+	buff.WriteString("\r\n\t\t\treturn errors;")
+	buff.WriteString("\r\n\t\t}")
+	buff.WriteString("\r\n")
+	buff.WriteString("\r\n\t\tprivate static T Parse<T>(string name, Func<string, string> readText, List<string> errors) where T : class")
+	buff.WriteString("\r\n\t\t{")
+	buff.WriteString("\r\n\t\t\tstring text = readText(name);")
+	buff.WriteString("\r\n\t\t\tif (text == null)")
+	buff.WriteString("\r\n\t\t\t{")
+	buff.WriteString("\r\n\t\t\t\terrors.Add(\"missing file: \" + name + \".json\");")
+	buff.WriteString("\r\n\t\t\t\treturn null;")
+	buff.WriteString("\r\n\t\t\t}")
+	buff.WriteString("\r\n\t\t\ttry")
+	buff.WriteString("\r\n\t\t\t{")
+	buff.WriteString("\r\n\t\t\t\tvar data = (T)Parser(typeof(T), text);")
+	buff.WriteString("\r\n\t\t\t\tif (data == null) errors.Add(name + \".json: no data\");")
+	buff.WriteString("\r\n\t\t\t\treturn data;")
+	buff.WriteString("\r\n\t\t\t}")
+	buff.WriteString("\r\n\t\t\tcatch (Exception e)")
+	buff.WriteString("\r\n\t\t\t{")
+	buff.WriteString("\r\n\t\t\t\terrors.Add(name + \".json: \" + e.Message);")
+	buff.WriteString("\r\n\t\t\t\treturn null;")
+	buff.WriteString("\r\n\t\t\t}")
+	buff.WriteString("\r\n\t\t}")
+	buff.WriteString("\r\n")
+	buff.WriteString(genSummary("检查数据行的主键, 替换数据前发现空行和重复的主键", "\r\n\t\t"))
+	buff.WriteString("\r\n\t\tprivate static void CheckKeys<K, V>(string source, V[] rows, List<string> errors) where V : class, IConfigStruct<K>")
+	buff.WriteString("\r\n\t\t{")
+	buff.WriteString("\r\n\t\t\tif (rows == null)")
+	buff.WriteString("\r\n\t\t\t{")
+	buff.WriteString("\r\n\t\t\t\terrors.Add(source + \": no data\");")
+	buff.WriteString("\r\n\t\t\t\treturn;")
+	buff.WriteString("\r\n\t\t\t}")
+	buff.WriteString("\r\n\t\t\tvar keys = new HashSet<K>();")
+	buff.WriteString("\r\n\t\t\tforeach (var row in rows)")
+	buff.WriteString("\r\n\t\t\t{")
+	buff.WriteString("\r\n\t\t\t\tif (row == null)")
+	buff.WriteString("\r\n\t\t\t\t\terrors.Add(source + \": null row\");")
+	buff.WriteString("\r\n\t\t\t\telse if (!keys.Add(row.GetKey()))")
+	buff.WriteString("\r\n\t\t\t\t\terrors.Add(source + \": duplicate key \" + row.GetKey());")
+	buff.WriteString("\r\n\t\t\t}")
+	buff.WriteString("\r\n\t\t}")
+	if !gen.opts.Net {
+		buff.WriteString("\r\n")
+		buff.WriteString("\r\n\t\tprivate static void Relate(string name, Action relate, List<string> errors)")
+		buff.WriteString("\r\n\t\t{")
+		buff.WriteString("\r\n\t\t\ttry")
+		buff.WriteString("\r\n\t\t\t{")
+		buff.WriteString("\r\n\t\t\t\trelate();")
+		buff.WriteString("\r\n\t\t\t}")
+		buff.WriteString("\r\n\t\t\tcatch (Exception e)")
+		buff.WriteString("\r\n\t\t\t{")
+		buff.WriteString("\r\n\t\t\t\terrors.Add(name + \": \" + e.Message);")
+		buff.WriteString("\r\n\t\t\t}")
+		buff.WriteString("\r\n\t\t}")
+	}
+	buff.WriteString("\r\n\t}")
+	buff.WriteString("\r\n}\r\n")
+	return buff.String()
+}
+
 // GenEnum 生成枚举
 func (gen *CSGen) GenEnum(name string) string {
 	enumDef := gen.cfgMap.EnumMap[name]
 	if enumDef == nil || len(enumDef.Items) == 0 {
-		fmt.Println("error: ", name, "定义无效")
+		cfgdef.Error(name, "定义无效")
 		return ""
 	}
 	var buff bytes.Buffer
@@ -91,26 +616,178 @@ func (gen *CSGen) GenEnum(name string) string {
 	buff.WriteString("\r\nnamespace " + namespace)
 	buff.WriteString("\r\n{")
 	buff.WriteString(genSummary(enumDef.Desc, "\r\n\t"))
-	buff.WriteString("\r\n\tpublic enum " + name)
+	if enumDef.IsFlags {
+		buff.WriteString("\r\n\t[System.Flags]")
+	}
+	if enumDef.Type != "" {
+		buff.WriteString("\r\n\tpublic enum " + name + " : " + gen.getTypeName(&cfgdef.FieldDef{Type: enumDef.Type}))
+	} else {
+		buff.WriteString("\r\n\tpublic enum " + name)
+	}
 	buff.WriteString("\r\n\t{")
-	name2 := name[:len(name)-4]
 	for i := 0; i < len(enumDef.Items); i++ {
 		item := enumDef.Items[i]
 		buff.WriteString(genSummary(item.Desc, "\r\n\t\t"))
-		buff.WriteString("\r\n\t\t" + name2 + item.Name + " = " + item.Value + ",")
+		buff.WriteString("\r\n\t\t" + gen.enumItemName(name, item.Name) + " = " + item.Value + ",")
 	}
 	buff.WriteString("\r\n\t}")
 	buff.WriteString("\r\n}\r\n")
 	return buff.String()
 }
 
+// GenUnion 生成联合体
+func (gen *CSGen) GenUnion(name string) string {
+	unionDef := gen.cfgMap.UnionMap[name]
+	if unionDef == nil || len(unionDef.Items) == 0 {
+		cfgdef.Error(name, "定义无效")
+		return ""
+	}
+	if gen.opts.Net {
+		return gen.genNetUnion(name, unionDef)
+	}
+	//JsonUtility和DataContract不能按Type创建变体, 联合体为具体的类, 各变体的字段合并到Data中, 访问变体时再转换为变体的结构体
+	dataName := name + "Data"
+	var buff2 bytes.Buffer
+	memberTypes := make(map[string]string)
+	for i := 0; i < len(unionDef.Items); i++ {
+		item := unionDef.Items[i]
+		if item.Struct == "" {
+			continue
+		}
+		structDef := gen.cfgMap.TableMap[item.Struct]
+		if structDef == nil {
+			cfgdef.Error(name, "变体", item.Name, "的结构体未定义", item.Struct)
+			return ""
+		}
+		for _, field := range gen.getFields(structDef) {
+			typeName := gen.getTypeName(field)
+			if rawType, _ := getRawType(field); rawType != "" {
+				typeName = rawType
+			}
+			typeName = genType(typeName, field.IsArray)
+			if t, ok := memberTypes[field.Name]; ok {
+				if t != typeName {
+					cfgdef.Error(name, "变体", item.Name, "的字段", field.Name, "和其他变体的同名字段类型不一致", typeName, t)
+					return ""
+				}
+				continue
+			}
+			memberTypes[field.Name] = typeName
+			buff2.WriteString(genSummary(field.Desc, "\r\n\t\t"))
+			buff2.WriteString(gen.genMember(typeName, field.Name))
+		}
+	}
+
+	var buff bytes.Buffer
+	buff.WriteString("// Code generated by game config export tool. DO NOT EDIT.")
+	buff.WriteString(gen.usingAttr())
+	buff.WriteString("\r\n\r\nnamespace " + namespace)
+	buff.WriteString("\r\n{")
+	buff.WriteString(genSummary(unionDef.Desc, "\r\n\t"))
+	buff.WriteString(gen.typeAttr())
+	buff.WriteString("\r\n\tpublic sealed class " + name)
+	buff.WriteString("\r\n\t{")
+	buff.WriteString(genSummary("类型", "\r\n\t\t"))
+	buff.WriteString(gen.genMember(unionDef.Enum, "Type"))
+	buff.WriteString(genSummary("各变体合并后的数据, 通过变体的属性访问", "\r\n\t\t"))
+	buff.WriteString(gen.genMember(dataName, "Data"))
+	for i := 0; i < len(unionDef.Items); i++ {
+		item := unionDef.Items[i]
+		if item.Struct == "" {
+			continue
+		}
+		cache := lowerFirst(item.Name)
+		desc := item.Desc
+		if desc == "" {
+			desc = item.Name
+		}
+		buff.WriteString("\r\n")
+		if gen.opts.Serializable {
+			buff.WriteString("\r\n\t\t[NonSerialized]")
+		}
+		buff.WriteString("\r\n\t\tprivate " + item.Struct + " " + cache + ";")
+		buff.WriteString(genSummary(desc+", 类型不是"+item.Name+"时为null", "\r\n\t\t"))
+		buff.WriteString("\r\n\t\tpublic " + item.Struct + " " + item.Name)
+		buff.WriteString("\r\n\t\t{")
+		buff.WriteString("\r\n\t\t\tget")
+		buff.WriteString("\r\n\t\t\t{")
+		buff.WriteString("\r\n\t\t\t\tif (" + cache + " == null && Type == " + unionDef.Enum + "." + gen.enumItemName(unionDef.Enum, item.Name) + " && Data != null) " +
+			cache + " = new " + item.Struct + "(Data);")
+		buff.WriteString("\r\n\t\t\t\treturn " + cache + ";")
+		buff.WriteString("\r\n\t\t\t}")
+		buff.WriteString("\r\n\t\t}")
+	}
+	if gen.cfgMap.NeedRelate(name) {
+		buff.WriteString("\r\n")
+		buff.WriteString(genSummary("关联当前变体数据的父子表", "\r\n\t\t"))
+		buff.WriteString("\r\n\t\tpublic void Relate()")
+		buff.WriteString("\r\n\t\t{")
+		for i := 0; i < len(unionDef.Items); i++ {
+			item := unionDef.Items[i]
+			if item.Struct != "" && gen.cfgMap.NeedRelate(item.Struct) {
+				buff.WriteString("\r\n\t\t\tif (" + item.Name + " != null) " + item.Name + ".Relate();")
+			}
+		}
+		buff.WriteString("\r\n\t\t}")
+	}
+	buff.WriteString("\r\n\t}")
+
+	buff.WriteString("\r\n")
+	buff.WriteString(genSummary(unionDef.Desc+"的数据, 包含全部变体的字段", "\r\n\t"))
+	buff.WriteString(gen.typeAttr())
+	buff.WriteString("\r\n\tpublic sealed class " + dataName)
+	buff.WriteString("\r\n\t{")
+	buff.WriteString(buff2.String())
+	buff.WriteString("\r\n\t}")
+	buff.WriteString("\r\n}\r\n")
+	return buff.String()
+}
+
+// checkKeys 生成替换数据前检查表格主键的语句
+func (gen *CSGen) checkKeys(name string, rows string, source string) string {
+	tableDef := gen.cfgMap.TableMap[name]
+	keyType := gen.getTypeName(tableDef.Fields[tableDef.Key])
+	return "CheckKeys<" + keyType + ", " + genStructName(name) + ">(\"" + source + "\", " + rows + ", errors);"
+}
+
+// getFields 获得需要导出的字段
+func (gen *CSGen) getFields(tableDef *cfgdef.TableDef) []*cfgdef.FieldDef {
+	var fields []*cfgdef.FieldDef
+	for i := 0; i < len(tableDef.Fields); i++ {
+		field := tableDef.Fields[i]
+		if field.Name != "" && field.Type != "" &&
+			(field.IsKey || field.UseFor == "A" || field.UseFor == cfgdef.ExportFlags.UseFor) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// getUnionsOf 获得使用结构体作为变体数据的联合体, 按名称排序
+func (gen *CSGen) getUnionsOf(structName string) []string {
+	var unions []string
+	for name, unionDef := range gen.cfgMap.UnionMap {
+		for _, item := range unionDef.Items {
+			if item.Struct == structName {
+				unions = append(unions, name)
+				break
+			}
+		}
+	}
+	sort.Strings(unions)
+	return unions
+}
+
 // GenTable 生成表
 func (gen *CSGen) GenTable(name string) string {
 	tableDef := gen.cfgMap.TableMap[name]
 	if tableDef == nil || len(tableDef.Fields) == 0 {
-		fmt.Println("error: ", name, "定义无效")
+		cfgdef.Error(name, "定义无效")
 		return ""
 	}
+	if gen.opts.Net {
+		return gen.genNetTable(name, tableDef)
+	}
 
 	structName := genStructName(name)
 	isTable := strings.HasSuffix(name, "Table")
@@ -120,15 +797,15 @@ func (gen *CSGen) GenTable(name string) string {
 	var buff2 bytes.Buffer
 
 	buff.WriteString("// Code generated by game config export tool. DO NOT EDIT.")
-	buff.WriteString("\r\nusing System.Runtime.Serialization;")
+	buff.WriteString(gen.usingAttr())
 	buff.WriteString("\r\n\r\nnamespace " + namespace)
 	buff.WriteString("\r\n{")
 
 	buff.WriteString(genSummary(tableDef.Desc, "\r\n\t"))
-	buff.WriteString("\r\n\t[DataContract]")
+	buff.WriteString(gen.typeAttr())
 	if isTable {
 		keyField = tableDef.Fields[tableDef.Key]
-		buff.WriteString("\r\n\tpublic class " + structName + " : IConfigStruct<" + getTypeName(keyField) + ">")
+		buff.WriteString("\r\n\tpublic class " + structName + " : IConfigStruct<" + gen.getTypeName(keyField) + ">")
 	} else {
 		buff.WriteString("\r\n\tpublic class " + structName)
 	}
@@ -138,28 +815,91 @@ func (gen *CSGen) GenTable(name string) string {
 		field := tableDef.Fields[i]
 		if field.Name != "" && field.Type != "" &&
 			(field.IsKey || field.UseFor == "A" || field.UseFor == cfgdef.ExportFlags.UseFor) {
-			typeName := getTypeName(field)
-			buff.WriteString(genSummary(field.Desc, "\r\n\t\t"))
-			buff.WriteString("\r\n\t\t[DataMember]")
-			buff.WriteString("\r\n\t\tpublic " + genType(typeName, field.IsArray) + " " + field.Name + " { get; private set; }")
-			if field.FTable != "" {
-				relateName := field.Name + "2" + field.FTable
-				buff.WriteString(genSummary(field.Name+" --> "+field.FTable, "\r\n\t\t"))
-				buff.WriteString("\r\n\t\tpublic " + genType(field.FTable+"Struct", field.IsArray) + " " + relateName + " { get; private set; }")
+			typeName := gen.getTypeName(field)
+			if rawType, conv := getRawType(field); rawType != "" && gen.opts.Fields {
+				//按字段名序列化, 原始数据保留在同名字段中, 转换后的值通过XxxValue访问
+				buff.WriteString(genSummary(field.Desc, "\r\n\t\t"))
+				buff.WriteString(gen.genMember(genType(rawType, field.IsArray), field.Name))
+				buff.WriteString(genSummary(field.Desc, "\r\n\t\t"))
+				buff.WriteString("\r\n\t\tpublic " + genType(typeName, field.IsArray) + " " + field.Name +
+					"Value { get { return CfgConvert." + conv + "(" + field.Name + "); } }")
+			} else if rawType != "" {
+				buff.WriteString("\r\n\t\t[DataMember(Name = \"" + field.Name + "\")]")
+				buff.WriteString("\r\n\t\tprivate " + genType(rawType, field.IsArray) + " _" + field.Name + " { get; set; }")
+				buff.WriteString(genSummary(field.Desc, "\r\n\t\t"))
+				buff.WriteString("\r\n\t\tpublic " + genType(typeName, field.IsArray) + " " + field.Name +
+					" { get { return CfgConvert." + conv + "(_" + field.Name + "); } }")
+			} else {
+				buff.WriteString(genSummary(field.Desc, "\r\n\t\t"))
+				buff.WriteString(gen.genMember(genType(typeName, field.IsArray), field.Name))
+			}
+			if (field.IsStruct || field.IsUnion) && gen.cfgMap.NeedRelate(field.Type) {
+				//嵌套的结构体和联合体中的关联
 				if field.IsArray {
-					buff2.WriteString("\r\n\t\t\t" + relateName + " = new " + field.FTable + "Struct[" + field.Name + ".Length];")
+					buff2.WriteString("\r\n\t\t\tif (" + field.Name + " != null)")
+					buff2.WriteString("\r\n\t\t\t{")
+					buff2.WriteString("\r\n\t\t\t\tfor (int i = 0; i < " + field.Name + ".Length; ++i)")
+					buff2.WriteString("\r\n\t\t\t\t\tif (" + field.Name + "[i] != null) " + field.Name + "[i].Relate();")
+					buff2.WriteString("\r\n\t\t\t}")
+				} else {
+					buff2.WriteString("\r\n\t\t\tif (" + field.Name + " != null) " + field.Name + ".Relate();")
+				}
+			}
+			if ftable := gen.cfgMap.GetRelateTable(field.FTable); ftable != "" {
+				relateName := field.Name + "2" + ftable
+				buff.WriteString(genSummary(field.Name+" --> "+ftable, "\r\n\t\t"))
+				buff.WriteString("\r\n\t\tpublic " + genType(ftable+"Struct", field.IsArray) + " " + relateName + " { get; private set; }")
+				if field.IsArray {
+					buff2.WriteString("\r\n\t\t\t" + relateName + " = new " + ftable + "Struct[" + field.Name + ".Length];")
 					buff2.WriteString("\r\n\t\t\tfor (int i = 0; i < " + field.Name + ".Length; ++i)")
 					buff2.WriteString("\r\n\t\t\t{")
-					buff2.WriteString("\r\n\t\t\t\t" + relateName + "[i] = Facade." + field.FTable + "Table[" + field.Name + "[i]];")
+					buff2.WriteString("\r\n\t\t\t\t" + relateName + "[i] = Facade." + ftable + "Table[" + field.Name + "[i]];")
+					if cfgdef.ExportFlags.BackRefs {
+						buff2.WriteString("\r\n\t\t\t\tif (" + relateName + "[i] != null) " + relateName + "[i].AddReference(new CfgRef(\"" + name + "\", \"" + field.Name + "\", this));")
+					}
 					buff2.WriteString("\r\n\t\t\t}")
 				} else {
-					buff2.WriteString("\r\n\t\t\t" + relateName + " = Facade." + field.FTable + "Table[" + field.Name + "];")
+					buff2.WriteString("\r\n\t\t\t" + relateName + " = Facade." + ftable + "Table[" + field.Name + "];")
+					if cfgdef.ExportFlags.BackRefs {
+						buff2.WriteString("\r\n\t\t\tif (" + relateName + " != null) " + relateName + ".AddReference(new CfgRef(\"" + name + "\", \"" + field.Name + "\", this));")
+					}
+				}
+			}
+		}
+	}
+	if unions := gen.getUnionsOf(name); len(unions) > 0 {
+		buff.WriteString("\r\n\r\n\t\tpublic " + structName + "() { }")
+		for _, union := range unions {
+			buff.WriteString(genSummary("从联合体"+union+"的数据构建", "\r\n\t\t"))
+			buff.WriteString("\r\n\t\tinternal " + structName + "(" + union + "Data data)")
+			buff.WriteString("\r\n\t\t{")
+			for _, field := range gen.getFields(tableDef) {
+				if rawType, _ := getRawType(field); rawType != "" && !gen.opts.Fields {
+					buff.WriteString("\r\n\t\t\t_" + field.Name + " = data." + field.Name + ";")
+				} else {
+					buff.WriteString("\r\n\t\t\t" + field.Name + " = data." + field.Name + ";")
 				}
 			}
+			buff.WriteString("\r\n\t\t}")
 		}
 	}
 	if isTable {
-		buff.WriteString("\r\n\r\n\t\tpublic " + getTypeName(keyField) + " GetKey() { return " + keyField.Name + "; }")
+		buff.WriteString("\r\n\r\n\t\tpublic " + gen.getTypeName(keyField) + " GetKey() { return " + keyField.Name + "; }")
+	}
+	if isTable && cfgdef.ExportFlags.BackRefs && gen.cfgMap.IsReferenced(name) {
+		if gen.opts.Serializable {
+			buff.WriteString("\r\n\r\n\t\t[NonSerialized]\r\n\t\tprivate System.Collections.Generic.List<CfgRef> referencedBy;")
+		} else {
+			buff.WriteString("\r\n\r\n\t\tprivate System.Collections.Generic.List<CfgRef> referencedBy;")
+		}
+		buff.WriteString(genSummary("引用该数据行的数据行, 各表关联(Relate)后可用", "\r\n\t\t"))
+		buff.WriteString("\r\n\t\tpublic System.Collections.Generic.IList<CfgRef> ReferencedBy()")
+		buff.WriteString("\r\n\t\t{")
+		buff.WriteString("\r\n\t\t\tif (referencedBy == null) referencedBy = new System.Collections.Generic.List<CfgRef>();")
+		buff.WriteString("\r\n\t\t\treturn referencedBy;")
+		buff.WriteString("\r\n\t\t}")
+		buff.WriteString("\r\n\r\n\t\tinternal void AddReference(CfgRef r) { ReferencedBy().Add(r); }")
+		buff.WriteString("\r\n\r\n\t\tinternal void ClearReferences() { referencedBy = null; }")
 	}
 	buff.WriteString("\r\n\r\n\t\tpublic void Relate()")
 	buff.WriteString("\r\n\t\t{")
@@ -171,8 +911,8 @@ func (gen *CSGen) GenTable(name string) string {
 		buff.WriteString("\r\n\r\n\tpublic partial class Facade")
 		buff.WriteString("\r\n\t{")
 		buff.WriteString(genSummary(tableDef.Desc, "\r\n\t\t"))
-		buff.WriteString("\r\n\t\tpublic static DataTable<" + getTypeName(keyField) + ", " + structName + "> " +
-			name + " = DataTable<" + getTypeName(keyField) + ", " + structName + ">.Instance;")
+		buff.WriteString("\r\n\t\tpublic static DataTable<" + gen.getTypeName(keyField) + ", " + structName + "> " +
+			name + " = DataTable<" + gen.getTypeName(keyField) + ", " + structName + ">.Instance;")
 		buff.WriteString("\r\n\t}")
 	} else if isSettings {
 		buff.WriteString("\r\n\r\n\tpublic partial class Facade")
@@ -0,0 +1,385 @@
+package csgen
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/gamewheels/cfgwheel/cfgdef"
+)
+
+// .NET模式(csnet): 使用System.Text.Json源生成加载, 生成record、DataTable运行时和JSON源生成上下文, 需要.NET 6以上
+
+func lowerFirst(s string) string {
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+// genNetRuntime 生成DataTable运行时和datetime、duration的JSON转换
+func genNetRuntime() string {
+	return "// Code generated by game config export tool. DO NOT EDIT." +
+		"\r\n#nullable disable" +
+		"\r\nusing System;" +
+		"\r\nusing System.Collections;" +
+		"\r\nusing System.Collections.Generic;" +
+		"\r\nusing System.IO;" +
+		"\r\nusing System.Text.Json;" +
+		"\r\nusing System.Text.Json.Serialization;" +
+		"\r\n\r\nnamespace " + namespace +
+		"\r\n{" +
+		strings.ReplaceAll(netRuntimeSource, "\n", "\r\n") +
+		"}\r\n"
+}
+
+const netRuntimeSource = `
+	/// <summary>
+	/// 配置表的数据行, 按主键索引
+	/// </summary>
+	public interface IConfigStruct<K>
+	{
+		K GetKey();
+	}
+
+	/// <summary>
+	/// 配置表, 按主键查找, 按表格中的顺序遍历
+	/// </summary>
+	public sealed class DataTable<K, V> : IReadOnlyCollection<V> where V : class, IConfigStruct<K>
+	{
+		public static readonly DataTable<K, V> Instance = new DataTable<K, V>();
+
+		private V[] rows = Array.Empty<V>();
+		private Dictionary<K, V> index = new Dictionary<K, V>();
+
+		/// <summary>
+		/// 按表格中的顺序返回全部数据行
+		/// </summary>
+		public IReadOnlyList<V> Values => rows;
+
+		public int Count => rows.Length;
+
+		/// <summary>
+		/// 按主键查找数据行, 找不到时抛出KeyNotFoundException
+		/// </summary>
+		public V this[K key] => index[key];
+
+		/// <summary>
+		/// 按主键查找数据行, 找不到时返回false
+		/// </summary>
+		public bool TryGetValue(K key, out V value) => index.TryGetValue(key, out value);
+
+		public bool ContainsKey(K key) => index.ContainsKey(key);
+
+		/// <summary>
+		/// 替换全部数据行, 主键重复时抛出InvalidDataException并保留原有的数据, 替换后需要重新关联全部表格
+		/// </summary>
+		public void Load(V[] rows)
+		{
+			var newIndex = new Dictionary<K, V>(rows.Length);
+			foreach (var row in rows)
+			{
+				if (row == null)
+					throw new InvalidDataException(typeof(V).Name + ": null row");
+				if (!newIndex.TryAdd(row.GetKey(), row))
+					throw new InvalidDataException(typeof(V).Name + ": duplicate key " + row.GetKey());
+			}
+			this.rows = rows;
+			index = newIndex;
+		}
+
+		public IEnumerator<V> GetEnumerator() => ((IEnumerable<V>)rows).GetEnumerator();
+
+		IEnumerator IEnumerable.GetEnumerator() => GetEnumerator();
+	}
+
+	/// <summary>
+	/// datetime 数据中为Unix时间戳(秒), 转换为UTC时间
+	/// </summary>
+	public sealed class UnixSecondsConverter : JsonConverter<DateTime>
+	{
+		public override DateTime Read(ref Utf8JsonReader reader, Type typeToConvert, JsonSerializerOptions options) =>
+			DateTimeOffset.FromUnixTimeSeconds(reader.GetInt64()).UtcDateTime;
+
+		public override void Write(Utf8JsonWriter writer, DateTime value, JsonSerializerOptions options) =>
+			writer.WriteNumberValue(new DateTimeOffset(value).ToUnixTimeSeconds());
+	}
+
+	/// <summary>
+	/// duration 数据中为毫秒
+	/// </summary>
+	public sealed class MillisecondsConverter : JsonConverter<TimeSpan>
+	{
+		public override TimeSpan Read(ref Utf8JsonReader reader, Type typeToConvert, JsonSerializerOptions options) =>
+			TimeSpan.FromMilliseconds(reader.GetInt64());
+
+		public override void Write(Utf8JsonWriter writer, TimeSpan value, JsonSerializerOptions options) =>
+			writer.WriteNumberValue((long)value.TotalMilliseconds);
+	}
+`
+
+// genNetContext 生成JSON源生成上下文, 包括全部表格、设置和结构体
+func (gen *CSGen) genNetContext() string {
+	var names []string
+	for name := range gen.cfgMap.TableMap {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+
+	var buff bytes.Buffer
+	buff.WriteString("// Code generated by game config export tool. DO NOT EDIT.")
+	buff.WriteString("\r\nusing System.Text.Json;")
+	buff.WriteString("\r\nusing System.Text.Json.Serialization;")
+	buff.WriteString("\r\n\r\nnamespace " + namespace)
+	buff.WriteString("\r\n{")
+	buff.WriteString(genSummary("JSON源生成的序列化上下文, 不使用反射, 支持AOT和裁剪", "\r\n\t"))
+	buff.WriteString("\r\n\t[JsonSourceGenerationOptions(GenerationMode = JsonSourceGenerationMode.Metadata)]")
+	for _, name := range names {
+		typeName := genStructName(name)
+		if strings.HasSuffix(name, "Table") {
+			typeName += "[]"
+		}
+		buff.WriteString("\r\n\t[JsonSerializable(typeof(" + typeName + "))]")
+	}
+	buff.WriteString("\r\n\tpublic partial class CfgJsonContext : JsonSerializerContext")
+	buff.WriteString("\r\n\t{")
+	buff.WriteString(genSummary("注册了datetime和duration转换的上下文, 加载配置数据时使用", "\r\n\t\t"))
+	buff.WriteString("\r\n\t\tpublic static CfgJsonContext Configured { get; } = new CfgJsonContext(new JsonSerializerOptions")
+	buff.WriteString("\r\n\t\t{")
+	buff.WriteString("\r\n\t\t\tConverters = { new UnixSecondsConverter(), new MillisecondsConverter() },")
+	buff.WriteString("\r\n\t\t});")
+	buff.WriteString("\r\n\t}")
+	buff.WriteString("\r\n}\r\n")
+	return buff.String()
+}
+
+// genNetUnion 生成联合体, 通过JsonConverter按Type解析Data
+func (gen *CSGen) genNetUnion(name string, unionDef *cfgdef.UnionDef) string {
+	baseName := name[:len(name)-5]
+	var buff bytes.Buffer
+	buff.WriteString("// Code generated by game config export tool. DO NOT EDIT.")
+	buff.WriteString("\r\n#nullable disable")
+	buff.WriteString("\r\nusing System;")
+	buff.WriteString("\r\nusing System.Collections.Generic;")
+	buff.WriteString("\r\nusing System.Text.Json;")
+	buff.WriteString("\r\nusing System.Text.Json.Serialization;")
+	buff.WriteString("\r\n\r\nnamespace " + namespace)
+	buff.WriteString("\r\n{")
+	buff.WriteString(genSummary(unionDef.Desc, "\r\n\t"))
+	buff.WriteString("\r\n\t[JsonConverter(typeof(" + name + "Converter))]")
+	buff.WriteString("\r\n\tpublic abstract record " + name)
+	buff.WriteString("\r\n\t{")
+	buff.WriteString(genSummary("类型", "\r\n\t\t"))
+	buff.WriteString("\r\n\t\tpublic abstract " + unionDef.Enum + " Type { get; }")
+	needRelate := gen.cfgMap.NeedRelate(name)
+	if needRelate {
+		buff.WriteString("\r\n")
+		buff.WriteString(genSummary("关联当前变体数据的父子表, 找不到的关联添加到errors", "\r\n\t\t"))
+		buff.WriteString("\r\n\t\tinternal virtual void Relate(string path, ICollection<string> errors) { }")
+	}
+	buff.WriteString("\r\n\t}")
+
+	for i := 0; i < len(unionDef.Items); i++ {
+		item := unionDef.Items[i]
+		buff.WriteString("\r\n")
+		buff.WriteString(genSummary(item.Desc, "\r\n\t"))
+		buff.WriteString("\r\n\tpublic sealed record " + baseName + item.Name + " : " + name)
+		buff.WriteString("\r\n\t{")
+		buff.WriteString("\r\n\t\tpublic override " + unionDef.Enum + " Type => " + unionDef.Enum + "." + gen.enumItemName(unionDef.Enum, item.Name) + ";")
+		if item.Struct != "" {
+			buff.WriteString("\r\n")
+			buff.WriteString(genSummary("数据", "\r\n\t\t"))
+			buff.WriteString("\r\n\t\tpublic " + item.Struct + " Data { get; init; }")
+			if needRelate && gen.cfgMap.NeedRelate(item.Struct) {
+				buff.WriteString("\r\n")
+				buff.WriteString("\r\n\t\tinternal override void Relate(string path, ICollection<string> errors) => Data?.Relate(path, errors);")
+			}
+		}
+		buff.WriteString("\r\n\t}")
+	}
+
+	buff.WriteString("\r\n")
+	buff.WriteString(genSummary("按Type解析Data, 数据格式: {\"Type\":1,\"Data\":{...}}", "\r\n\t"))
+	buff.WriteString("\r\n\tpublic sealed class " + name + "Converter : JsonConverter<" + name + ">")
+	buff.WriteString("\r\n\t{")
+	buff.WriteString("\r\n\t\tpublic override " + name + " Read(ref Utf8JsonReader reader, Type typeToConvert, JsonSerializerOptions options)")
+	buff.WriteString("\r\n\t\t{")
+	buff.WriteString("\r\n\t\t\tusing var doc = JsonDocument.ParseValue(ref reader);")
+	buff.WriteString("\r\n\t\t\tvar root = doc.RootElement;")
+	buff.WriteString("\r\n\t\t\tif (root.ValueKind != JsonValueKind.Object || !root.TryGetProperty(\"Type\", out var type))")
+	buff.WriteString("\r\n\t\t\t\tthrow new JsonException(\"" + name + ": missing Type\");")
+	buff.WriteString("\r\n\t\t\tbool hasData = root.TryGetProperty(\"Data\", out var data) && data.ValueKind == JsonValueKind.Object;")
+	buff.WriteString("\r\n\t\t\tswitch ((" + unionDef.Enum + ")type.GetInt64())")
+	buff.WriteString("\r\n\t\t\t{")
+	for i := 0; i < len(unionDef.Items); i++ {
+		item := unionDef.Items[i]
+		buff.WriteString("\r\n\t\t\t\tcase " + unionDef.Enum + "." + gen.enumItemName(unionDef.Enum, item.Name) + ":")
+		if item.Struct != "" {
+			buff.WriteString("\r\n\t\t\t\t\treturn new " + baseName + item.Name + " { Data = hasData ? data.Deserialize(CfgJsonContext.Configured." + item.Struct + ") : null };")
+		} else {
+			buff.WriteString("\r\n\t\t\t\t\treturn new " + baseName + item.Name + "();")
+		}
+	}
+	buff.WriteString("\r\n\t\t\t\tdefault:")
+	buff.WriteString("\r\n\t\t\t\t\treturn null;")
+	buff.WriteString("\r\n\t\t\t}")
+	buff.WriteString("\r\n\t\t}")
+	buff.WriteString("\r\n")
+	buff.WriteString("\r\n\t\tpublic override void Write(Utf8JsonWriter writer, " + name + " value, JsonSerializerOptions options) =>")
+	buff.WriteString("\r\n\t\t\tthrow new NotSupportedException(\"" + name + " is read-only\");")
+	buff.WriteString("\r\n\t}")
+	buff.WriteString("\r\n}\r\n")
+	return buff.String()
+}
+
+// genNetTable 生成表格、设置或者结构体的record, 关联使用TryGetValue, 找不到的关联返回错误
+func (gen *CSGen) genNetTable(name string, tableDef *cfgdef.TableDef) string {
+	structName := genStructName(name)
+	isTable := strings.HasSuffix(name, "Table")
+	isSettings := strings.HasSuffix(name, "Settings")
+	var keyField *cfgdef.FieldDef
+	var buff bytes.Buffer
+	var buff2 bytes.Buffer
+	var members []string
+	hasRelates := false
+
+	rowName := name
+	if isTable {
+		keyField = tableDef.Fields[tableDef.Key]
+		rowName = name + "[{" + keyField.Name + "}]"
+	}
+
+	buff.WriteString("// Code generated by game config export tool. DO NOT EDIT.")
+	buff.WriteString("\r\n#nullable disable")
+	buff.WriteString("\r\nusing System.Collections.Generic;")
+	buff.WriteString("\r\nusing System.Text.Json.Serialization;")
+	buff.WriteString("\r\n\r\nnamespace " + namespace)
+	buff.WriteString("\r\n{")
+
+	buff.WriteString(genSummary(tableDef.Desc, "\r\n\t"))
+	if isTable {
+		buff.WriteString("\r\n\tpublic sealed record " + structName + " : IConfigStruct<" + gen.getTypeName(keyField) + ">")
+	} else {
+		buff.WriteString("\r\n\tpublic sealed record " + structName)
+	}
+	buff.WriteString("\r\n\t{")
+
+	for i := 0; i < len(tableDef.Fields); i++ {
+		field := tableDef.Fields[i]
+		if field.Name != "" && field.Type != "" &&
+			(field.IsKey || field.UseFor == "A" || field.UseFor == cfgdef.ExportFlags.UseFor) {
+			members = append(members, field.Name)
+			buff.WriteString(genSummary(field.Desc, "\r\n\t\t"))
+			buff.WriteString("\r\n\t\tpublic " + genType(gen.getTypeName(field), field.IsArray) + " " + field.Name + " { get; init; }")
+			if (field.IsStruct || field.IsUnion) && gen.cfgMap.NeedRelate(field.Type) {
+				//嵌套的结构体和联合体中的关联, 错误信息加上所在的字段
+				if field.IsArray {
+					buff2.WriteString("\r\n\t\t\tfor (int i = 0; i < (" + field.Name + "?.Length ?? 0); ++i)")
+					buff2.WriteString("\r\n\t\t\t\t" + field.Name + "[i]?.Relate($\"{path}." + field.Name + "[{i}]\", errors);")
+				} else {
+					buff2.WriteString("\r\n\t\t\t" + field.Name + "?.Relate(path + \"." + field.Name + "\", errors);")
+				}
+			}
+			if ftable := gen.cfgMap.GetRelateTable(field.FTable); ftable != "" {
+				hasRelates = true
+				relateName := field.Name + "2" + ftable
+				//0和空字符串表示没有关联
+				hasValue := field.Name + " != 0"
+				if field.Type == "string" {
+					hasValue = "!string.IsNullOrEmpty(" + field.Name + ")"
+				}
+				buff.WriteString(genSummary(field.Name+" --> "+ftable, "\r\n\t\t"))
+				buff.WriteString("\r\n\t\t[JsonIgnore]")
+				buff.WriteString("\r\n\t\tpublic " + genType(ftable+"Struct", field.IsArray) + " " + relateName + " { get; private set; }")
+				if field.IsArray {
+					hasValue = strings.Replace(hasValue, field.Name, field.Name+"[i]", 1)
+					buff2.WriteString("\r\n\t\t\t" + relateName + " = new " + ftable + "Struct[" + field.Name + "?.Length ?? 0];")
+					buff2.WriteString("\r\n\t\t\tfor (int i = 0; i < " + relateName + ".Length; ++i)")
+					buff2.WriteString("\r\n\t\t\t{")
+					buff2.WriteString("\r\n\t\t\t\tif (!(" + hasValue + "))")
+					buff2.WriteString("\r\n\t\t\t\t\tcontinue;")
+					buff2.WriteString("\r\n\t\t\t\tif (Facade." + ftable + "Table.TryGetValue(" + field.Name + "[i], out var " + lowerFirst(relateName) + "))")
+					buff2.WriteString("\r\n\t\t\t\t{")
+					buff2.WriteString("\r\n\t\t\t\t\t" + relateName + "[i] = " + lowerFirst(relateName) + ";")
+					if cfgdef.ExportFlags.BackRefs {
+						buff2.WriteString("\r\n\t\t\t\t\t" + lowerFirst(relateName) + ".AddReference(new CfgRef(\"" + name + "\", \"" + field.Name + "\", this));")
+					}
+					buff2.WriteString("\r\n\t\t\t\t}")
+					buff2.WriteString("\r\n\t\t\t\telse")
+					buff2.WriteString("\r\n\t\t\t\t\terrors.Add($\"{path}." + field.Name + "[{i}]: can't find " + ftable + " {" + field.Name + "[i]}\");")
+					buff2.WriteString("\r\n\t\t\t}")
+				} else {
+					buff2.WriteString("\r\n\t\t\t" + relateName + " = null;")
+					buff2.WriteString("\r\n\t\t\tif (" + hasValue + ")")
+					buff2.WriteString("\r\n\t\t\t{")
+					buff2.WriteString("\r\n\t\t\t\tif (Facade." + ftable + "Table.TryGetValue(" + field.Name + ", out var " + lowerFirst(relateName) + "))")
+					buff2.WriteString("\r\n\t\t\t\t{")
+					buff2.WriteString("\r\n\t\t\t\t\t" + relateName + " = " + lowerFirst(relateName) + ";")
+					if cfgdef.ExportFlags.BackRefs {
+						buff2.WriteString("\r\n\t\t\t\t\t" + lowerFirst(relateName) + ".AddReference(new CfgRef(\"" + name + "\", \"" + field.Name + "\", this));")
+					}
+					buff2.WriteString("\r\n\t\t\t\t}")
+					buff2.WriteString("\r\n\t\t\t\telse")
+					buff2.WriteString("\r\n\t\t\t\t\terrors.Add($\"{path}." + field.Name + ": can't find " + ftable + " {" + field.Name + "}\");")
+					buff2.WriteString("\r\n\t\t\t}")
+				}
+			}
+		}
+	}
+	if isTable {
+		buff.WriteString("\r\n\r\n\t\tpublic " + gen.getTypeName(keyField) + " GetKey() => " + keyField.Name + ";")
+	}
+	isReferenced := isTable && cfgdef.ExportFlags.BackRefs && gen.cfgMap.IsReferenced(name)
+	if isReferenced {
+		hasRelates = true
+		buff.WriteString("\r\n\r\n\t\tprivate List<CfgRef> referencedBy;")
+		buff.WriteString(genSummary("引用该数据行的数据行, 各表关联(Relate)后可用", "\r\n\t\t"))
+		buff.WriteString("\r\n\t\tpublic IList<CfgRef> ReferencedBy() => referencedBy ??= new List<CfgRef>();")
+		buff.WriteString("\r\n\r\n\t\tinternal void AddReference(CfgRef r) => ReferencedBy().Add(r);")
+		buff.WriteString("\r\n\r\n\t\tinternal void ClearReferences() => referencedBy = null;")
+	}
+	buff.WriteString("\r\n")
+	buff.WriteString(genSummary("关联父子表, 找不到的关联添加到errors, 0和空字符串表示没有关联", "\r\n\t\t"))
+	buff.WriteString("\r\n\t\tpublic void Relate(ICollection<string> errors) => Relate($\"" + rowName + "\", errors);")
+	buff.WriteString("\r\n")
+	buff.WriteString(genSummary("关联父子表, path为错误信息中的数据位置, 嵌套的结构体和联合体使用所在的字段", "\r\n\t\t"))
+	buff.WriteString("\r\n\t\tinternal void Relate(string path, ICollection<string> errors)")
+	buff.WriteString("\r\n\t\t{")
+	buff.WriteString(buff2.String())
+	buff.WriteString("\r\n\t\t}")
+	if hasRelates {
+		buff.WriteString("\r\n\r\n\t\t//关联的数据行可能循环引用, 使用引用相等, 打印时不展开关联")
+		buff.WriteString("\r\n\t\tpublic bool Equals(" + structName + " other) => ReferenceEquals(this, other);")
+		buff.WriteString("\r\n\r\n\t\tpublic override int GetHashCode() => System.Runtime.CompilerServices.RuntimeHelpers.GetHashCode(this);")
+		buff.WriteString("\r\n\r\n\t\tprivate bool PrintMembers(System.Text.StringBuilder builder)")
+		buff.WriteString("\r\n\t\t{")
+		for i, member := range members {
+			sep := ", "
+			if i == 0 {
+				sep = ""
+			}
+			buff.WriteString("\r\n\t\t\tbuilder.Append(\"" + sep + member + " = \").Append(" + member + ");")
+		}
+		buff.WriteString("\r\n\t\t\treturn true;")
+		buff.WriteString("\r\n\t\t}")
+	}
+	buff.WriteString("\r\n\t}")
+
+	if isTable {
+		buff.WriteString("\r\n\r\n\tpublic partial class Facade")
+		buff.WriteString("\r\n\t{")
+		buff.WriteString(genSummary(tableDef.Desc, "\r\n\t\t"))
+		buff.WriteString("\r\n\t\tpublic static DataTable<" + gen.getTypeName(keyField) + ", " + structName + "> " +
+			name + " = DataTable<" + gen.getTypeName(keyField) + ", " + structName + ">.Instance;")
+		buff.WriteString("\r\n\t}")
+	} else if isSettings {
+		buff.WriteString("\r\n\r\n\tpublic partial class Facade")
+		buff.WriteString("\r\n\t{")
+		buff.WriteString(genSummary(tableDef.Desc, "\r\n\t\t"))
+		buff.WriteString("\r\n\t\tpublic static " + structName + " " + name + ";")
+		buff.WriteString("\r\n\t}")
+	}
+
+	buff.WriteString("\r\n}\r\n")
+	return buff.String()
+}
@@ -2,7 +2,7 @@ package gogen
 
 import (
 	"bytes"
-	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/gamewheels/cfgwheel/cfgdef"
@@ -11,6 +11,9 @@ import (
 // 生成包名
 var packageName = "gameconfig"
 
+// EmbedDir 嵌入的配置数据相对于生成代码的目录
+const EmbedDir = "data"
+
 // GoGen golang胶水代码生成器
 type GoGen struct {
 	cfgMap *cfgdef.CfgMap
@@ -32,6 +35,34 @@ func genStructName(name string) string {
 	return name
 }
 
+func getTypeName(field *cfgdef.FieldDef) string {
+	switch field.Type {
+	case "datetime":
+		return "DateTime"
+	case "duration":
+		return "Duration"
+	case "fixed":
+		return "Fixed"
+	case "text":
+		return "string"
+	case "vec2":
+		return "Vec2"
+	case "vec3":
+		return "Vec3"
+	case "color":
+		return "Color"
+	}
+	if elemType := cfgdef.GetRangeType(field.Type); elemType != "" {
+		return getRangeName(elemType)
+	}
+	return field.Type
+}
+
+// getRangeName 获得取值范围类型名称, 如: range<int32> -> RangeInt32
+func getRangeName(elemType string) string {
+	return "Range" + strings.ToUpper(elemType[:1]) + elemType[1:]
+}
+
 // GenType 生成类型名称
 func genType(typeName string, isArray bool) string {
 	return cfgdef.GetArraySymbol(isArray) + typeName
@@ -42,26 +73,699 @@ func (gen *GoGen) GenFileName(name string) string {
 	return name + ".go"
 }
 
+// GenCommonFiles 生成公共类型定义
+func (gen *GoGen) GenCommonFiles() map[string]string {
+	files := make(map[string]string)
+	hasDateTime := gen.cfgMap.HasFieldType("datetime")
+	hasDuration := gen.cfgMap.HasFieldType("duration")
+	hasFixed := gen.cfgMap.HasFieldType("fixed")
+
+	var buff2 bytes.Buffer
+	if hasDateTime {
+		buff2.WriteString("\n\n// DateTime 日期时间, 数据中为Unix时间戳(秒)")
+		buff2.WriteString("\ntype DateTime struct {")
+		buff2.WriteString("\n\ttime.Time")
+		buff2.WriteString("\n}")
+		buff2.WriteString("\n\n// UnmarshalJSON UnmarshalJSON")
+		buff2.WriteString("\nfunc (t *DateTime) UnmarshalJSON(s []byte) error {")
+		buff2.WriteString("\n\tvar v int64")
+		buff2.WriteString("\n\tif err := json.Unmarshal(s, &v); err != nil {")
+		buff2.WriteString("\n\t\treturn err")
+		buff2.WriteString("\n\t}")
+		buff2.WriteString("\n\tt.Time = time.Unix(v, 0)")
+		buff2.WriteString("\n\treturn nil")
+		buff2.WriteString("\n}")
+		buff2.WriteString("\n\n// MarshalJSON MarshalJSON")
+		buff2.WriteString("\nfunc (t DateTime) MarshalJSON() ([]byte, error) {")
+		buff2.WriteString("\n\treturn json.Marshal(t.Unix())")
+		buff2.WriteString("\n}")
+	}
+	if hasDuration {
+		buff2.WriteString("\n\n// Duration 时长, 数据中为毫秒")
+		buff2.WriteString("\ntype Duration struct {")
+		buff2.WriteString("\n\ttime.Duration")
+		buff2.WriteString("\n}")
+		buff2.WriteString("\n\n// UnmarshalJSON UnmarshalJSON")
+		buff2.WriteString("\nfunc (d *Duration) UnmarshalJSON(s []byte) error {")
+		buff2.WriteString("\n\tvar v int64")
+		buff2.WriteString("\n\tif err := json.Unmarshal(s, &v); err != nil {")
+		buff2.WriteString("\n\t\treturn err")
+		buff2.WriteString("\n\t}")
+		buff2.WriteString("\n\td.Duration = time.Duration(v) * time.Millisecond")
+		buff2.WriteString("\n\treturn nil")
+		buff2.WriteString("\n}")
+		buff2.WriteString("\n\n// MarshalJSON MarshalJSON")
+		buff2.WriteString("\nfunc (d Duration) MarshalJSON() ([]byte, error) {")
+		buff2.WriteString("\n\treturn json.Marshal(d.Milliseconds())")
+		buff2.WriteString("\n}")
+	}
+	if hasFixed {
+		bits := strconv.FormatUint(uint64(cfgdef.ExportFlags.FixedBits), 10)
+		buff2.WriteString("\n\n// FixedBits 定点数的小数位数")
+		buff2.WriteString("\nconst FixedBits = " + bits)
+		buff2.WriteString("\n\n// Fixed Q" + strconv.FormatUint(uint64(63-cfgdef.ExportFlags.FixedBits), 10) + "." + bits + "定点数, 数据中为原始值")
+		buff2.WriteString("\ntype Fixed int64")
+		buff2.WriteString("\n\n// FixedFromInt 整数转换为定点数")
+		buff2.WriteString("\nfunc FixedFromInt(v int64) Fixed {")
+		buff2.WriteString("\n\treturn Fixed(v << FixedBits)")
+		buff2.WriteString("\n}")
+		buff2.WriteString("\n\n// Int 取整数部分(向下取整)")
+		buff2.WriteString("\nfunc (f Fixed) Int() int64 {")
+		buff2.WriteString("\n\treturn int64(f) >> FixedBits")
+		buff2.WriteString("\n}")
+		buff2.WriteString("\n\n// Float64 转换为浮点数, 仅用于显示, 逻辑计算请使用定点数")
+		buff2.WriteString("\nfunc (f Fixed) Float64() float64 {")
+		buff2.WriteString("\n\treturn float64(f) / (1 << FixedBits)")
+		buff2.WriteString("\n}")
+		buff2.WriteString("\n\n// Mul 乘法, 使用128位的中间结果, 避免溢出")
+		buff2.WriteString("\nfunc (f Fixed) Mul(v Fixed) Fixed {")
+		buff2.WriteString("\n\thi, lo := bits.Mul64(uint64(f), uint64(v))")
+		buff2.WriteString("\n\t//无符号的乘积转换为有符号的乘积")
+		buff2.WriteString("\n\tif f < 0 {")
+		buff2.WriteString("\n\t\thi -= uint64(v)")
+		buff2.WriteString("\n\t}")
+		buff2.WriteString("\n\tif v < 0 {")
+		buff2.WriteString("\n\t\thi -= uint64(f)")
+		buff2.WriteString("\n\t}")
+		buff2.WriteString("\n\treturn Fixed(hi<<(64-FixedBits) | lo>>FixedBits)")
+		buff2.WriteString("\n}")
+		buff2.WriteString("\n\n// Div 除法, 使用128位的被除数, 避免溢出, 结果向零取整")
+		buff2.WriteString("\nfunc (f Fixed) Div(v Fixed) Fixed {")
+		buff2.WriteString("\n\ta, b := uint64(f), uint64(v)")
+		buff2.WriteString("\n\tif f < 0 {")
+		buff2.WriteString("\n\t\ta = -a")
+		buff2.WriteString("\n\t}")
+		buff2.WriteString("\n\tif v < 0 {")
+		buff2.WriteString("\n\t\tb = -b")
+		buff2.WriteString("\n\t}")
+		buff2.WriteString("\n\t//高位先取余数, 结果超出范围时和整数运算一样回绕")
+		buff2.WriteString("\n\tq, _ := bits.Div64((a>>(64-FixedBits))%b, a<<FixedBits, b)")
+		buff2.WriteString("\n\tif (f < 0) != (v < 0) {")
+		buff2.WriteString("\n\t\treturn -Fixed(q)")
+		buff2.WriteString("\n\t}")
+		buff2.WriteString("\n\treturn Fixed(q)")
+		buff2.WriteString("\n}")
+		buff2.WriteString("\n\n// String String")
+		buff2.WriteString("\nfunc (f Fixed) String() string {")
+		buff2.WriteString("\n\treturn strconv.FormatFloat(f.Float64(), 'f', -1, 64)")
+		buff2.WriteString("\n}")
+	}
+	if gen.cfgMap.HasFieldType("vec2") {
+		buff2.WriteString("\n\n// Vec2 二维向量")
+		buff2.WriteString("\ntype Vec2 struct {")
+		buff2.WriteString("\n\tX float32 `json:\"x\"`")
+		buff2.WriteString("\n\tY float32 `json:\"y\"`")
+		buff2.WriteString("\n}")
+	}
+	if gen.cfgMap.HasFieldType("vec3") {
+		buff2.WriteString("\n\n// Vec3 三维向量")
+		buff2.WriteString("\ntype Vec3 struct {")
+		buff2.WriteString("\n\tX float32 `json:\"x\"`")
+		buff2.WriteString("\n\tY float32 `json:\"y\"`")
+		buff2.WriteString("\n\tZ float32 `json:\"z\"`")
+		buff2.WriteString("\n}")
+	}
+	if gen.cfgMap.HasFieldType("color") {
+		buff2.WriteString("\n\n// Color 颜色, 各分量的取值范围为0~1")
+		buff2.WriteString("\ntype Color struct {")
+		buff2.WriteString("\n\tR float32 `json:\"r\"`")
+		buff2.WriteString("\n\tG float32 `json:\"g\"`")
+		buff2.WriteString("\n\tB float32 `json:\"b\"`")
+		buff2.WriteString("\n\tA float32 `json:\"a\"`")
+		buff2.WriteString("\n}")
+	}
+	for _, elemType := range gen.cfgMap.GetRangeTypes() {
+		rangeName := getRangeName(elemType)
+		buff2.WriteString("\n\n// " + rangeName + " " + elemType + "取值范围")
+		buff2.WriteString("\ntype " + rangeName + " struct {")
+		buff2.WriteString("\n\tMin " + elemType + " `json:\"min\"`")
+		buff2.WriteString("\n\tMax " + elemType + " `json:\"max\"`")
+		buff2.WriteString("\n}")
+		buff2.WriteString("\n\n// Contains 是否在取值范围内")
+		buff2.WriteString("\nfunc (r " + rangeName + ") Contains(v " + elemType + ") bool {")
+		buff2.WriteString("\n\treturn v >= r.Min && v <= r.Max")
+		buff2.WriteString("\n}")
+	}
+	if cfgdef.ExportFlags.BackRefs {
+		buff2.WriteString("\n\n// CfgRef 外键引用, Row为引用方的数据行")
+		buff2.WriteString("\ntype CfgRef struct {")
+		buff2.WriteString("\n\tTable string")
+		buff2.WriteString("\n\tField string")
+		buff2.WriteString("\n\tRow   interface{}")
+		buff2.WriteString("\n}")
+	}
+
+	//没有用到公共类型时不生成CfgTypes.go, 表格、注册表和清单仍然需要生成
+	if buff2.Len() > 0 {
+		var buff bytes.Buffer
+		buff.WriteString("// Code generated by game config export tool. DO NOT EDIT.")
+		buff.WriteString("\npackage " + packageName)
+		var imports []string
+		if hasDateTime || hasDuration {
+			imports = append(imports, "encoding/json")
+		}
+		if hasFixed {
+			imports = append(imports, "math/bits", "strconv")
+		}
+		if hasDateTime || hasDuration {
+			imports = append(imports, "time")
+		}
+		if len(imports) > 0 {
+			buff.WriteString("\n\nimport (")
+			for _, imp := range imports {
+				buff.WriteString("\n\t\"" + imp + "\"")
+			}
+			buff.WriteString("\n)")
+		}
+		buff.WriteString(buff2.String())
+		buff.WriteString("\n")
+		files["CfgTypes.go"] = buff.String()
+	}
+	if s := gen.genTableType(); s != "" {
+		files["CfgTable.go"] = s
+	}
+	if s := gen.genRegistry(); s != "" {
+		files["CfgRegistry.go"] = s
+		files["CfgManifest.go"] = gen.genManifest()
+		if cfgdef.ExportFlags.GoEmbed {
+			files["CfgEmbed.go"] = gen.genEmbed()
+		}
+	}
+	return files
+}
+
+// genEmbed 生成嵌入配置数据的加载代码, 配置数据在EmbedDir目录中
+func (gen *GoGen) genEmbed() string {
+	var buff bytes.Buffer
+	buff.WriteString("// Code generated by game config export tool. DO NOT EDIT.")
+	buff.WriteString("\npackage " + packageName)
+	buff.WriteString("\n\nimport (")
+	buff.WriteString("\n\t\"embed\"")
+	buff.WriteString("\n\t\"io/fs\"")
+	buff.WriteString("\n)")
+
+	buff.WriteString("\n\n//go:embed " + EmbedDir + "/*.json")
+	buff.WriteString("\nvar embedFS embed.FS")
+
+	buff.WriteString("\n\n// EmbeddedFS 嵌入的配置数据, 如: Registry.LoadFS(EmbeddedFS())")
+	buff.WriteString("\nfunc EmbeddedFS() fs.FS {")
+	buff.WriteString("\n\tfsys, _ := fs.Sub(embedFS, \"" + EmbedDir + "\")")
+	buff.WriteString("\n\treturn fsys")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// LoadEmbedded 从嵌入的配置数据加载全部表格和设置并关联父子表, 返回全部错误")
+	buff.WriteString("\nfunc LoadEmbedded() error {")
+	buff.WriteString("\n\treturn LoadAllFS(EmbeddedFS())")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// LoadEmbedded 从嵌入的配置数据加载全部配置数据, 失败时保留当前快照并返回全部错误")
+	buff.WriteString("\nfunc (r *Registry) LoadEmbedded() error {")
+	buff.WriteString("\n\treturn r.LoadFS(EmbeddedFS())")
+	buff.WriteString("\n}")
+	buff.WriteString("\n")
+	return buff.String()
+}
+
+// genManifest 生成全部表格和设置的清单, 按清单加载全部配置数据并关联
+func (gen *GoGen) genManifest() string {
+	names := gen.cfgMap.GetDataNames()
+	if len(names) == 0 {
+		return ""
+	}
+
+	var buff bytes.Buffer
+	buff.WriteString("// Code generated by game config export tool. DO NOT EDIT.")
+	buff.WriteString("\npackage " + packageName)
+	buff.WriteString("\n\nimport (")
+	buff.WriteString("\n\t\"io/fs\"")
+	buff.WriteString("\n\t\"os\"")
+	buff.WriteString("\n)")
+
+	buff.WriteString("\n\n// Manifest 全部表格和设置的名称")
+	buff.WriteString("\nvar Manifest = []string{")
+	for i, name := range names {
+		if i > 0 {
+			buff.WriteString(", ")
+		}
+		buff.WriteString("\"" + name + "\"")
+	}
+	buff.WriteString("}")
+
+	buff.WriteString("\n\n// LoadAll 从目录加载全部表格和设置, 全部加载成功后关联父子表, 返回全部错误, 如: 缺少文件")
+	buff.WriteString("\nfunc LoadAll(dir string) error {")
+	buff.WriteString("\n\treturn LoadAllFS(os.DirFS(dir))")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// LoadAllFS 从文件系统加载全部表格和设置, 全部解析和关联成功后才替换全局数据, 失败时保留当前数据并返回全部错误, 如: 缺少文件")
+	buff.WriteString("\nfunc LoadAllFS(fsys fs.FS) error {")
+	buff.WriteString("\n\ts, err := parseSnapshot(fsys, 0)")
+	buff.WriteString("\n\tif err != nil {")
+	buff.WriteString("\n\t\treturn err")
+	buff.WriteString("\n\t}")
+	buff.WriteString("\n\terr = s.relate()")
+	buff.WriteString("\n\tif err != nil {")
+	buff.WriteString("\n\t\treturn err")
+	buff.WriteString("\n\t}")
+	for _, name := range names {
+		if strings.HasSuffix(name, "Table") {
+			buff.WriteString("\n\t" + name + " = s." + name)
+		} else {
+			buff.WriteString("\n\t" + name + " = *s." + name)
+		}
+	}
+	buff.WriteString("\n\treturn nil")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// RelateAll 关联全部表格和设置的父子表, 返回全部找不到的关联")
+	buff.WriteString("\nfunc RelateAll() error {")
+	buff.WriteString("\n\treturn globalSnapshot().relate()")
+	buff.WriteString("\n}")
+	buff.WriteString("\n")
+	return buff.String()
+}
+
+// genTableType 生成泛型配置表和二级索引, 全部配置表共用
+func (gen *GoGen) genTableType() string {
+	hasTable := false
+	for name := range gen.cfgMap.TableMap {
+		if strings.HasSuffix(name, "Table") {
+			hasTable = true
+			break
+		}
+	}
+	if !hasTable {
+		return ""
+	}
+
+	var buff bytes.Buffer
+	buff.WriteString("// Code generated by game config export tool. DO NOT EDIT.")
+	buff.WriteString("\npackage " + packageName)
+	buff.WriteString("\n\nimport \"fmt\"")
+
+	buff.WriteString("\n\n// Table 配置表, 按主键查找, 按表格中的顺序遍历")
+	buff.WriteString("\ntype Table[K comparable, V any] struct {")
+	buff.WriteString("\n\trows []V")
+	buff.WriteString("\n\tpos  map[K]int")
+	buff.WriteString("\n\tkey  func(V) K")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// NewTable 构建配置表, key返回数据行的主键")
+	buff.WriteString("\nfunc NewTable[K comparable, V any](key func(V) K) *Table[K, V] {")
+	buff.WriteString("\n\treturn &Table[K, V]{pos: make(map[K]int), key: key}")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// Len 数据行数")
+	buff.WriteString("\nfunc (t *Table[K, V]) Len() int {")
+	buff.WriteString("\n\treturn len(t.rows)")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// Get 按主键查找数据行")
+	buff.WriteString("\nfunc (t *Table[K, V]) Get(k K) (v V, ok bool) {")
+	buff.WriteString("\n\tif i, ok := t.pos[k]; ok {")
+	buff.WriteString("\n\t\treturn t.rows[i], true")
+	buff.WriteString("\n\t}")
+	buff.WriteString("\n\treturn v, false")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// MustGet 按主键查找数据行, 找不到时panic")
+	buff.WriteString("\nfunc (t *Table[K, V]) MustGet(k K) V {")
+	buff.WriteString("\n\ti, ok := t.pos[k]")
+	buff.WriteString("\n\tif !ok {")
+	buff.WriteString("\n\t\tpanic(fmt.Sprintf(\"can't find key %v\", k))")
+	buff.WriteString("\n\t}")
+	buff.WriteString("\n\treturn t.rows[i]")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// All 按表格中的顺序返回全部数据行, 不要修改返回的切片")
+	buff.WriteString("\nfunc (t *Table[K, V]) All() []V {")
+	buff.WriteString("\n\treturn t.rows")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// Keys 按表格中的顺序返回全部主键")
+	buff.WriteString("\nfunc (t *Table[K, V]) Keys() []K {")
+	buff.WriteString("\n\tkeys := make([]K, len(t.rows))")
+	buff.WriteString("\n\tfor i, v := range t.rows {")
+	buff.WriteString("\n\t\tkeys[i] = t.key(v)")
+	buff.WriteString("\n\t}")
+	buff.WriteString("\n\treturn keys")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// Filter 按表格中的顺序返回满足条件的数据行")
+	buff.WriteString("\nfunc (t *Table[K, V]) Filter(fn func(V) bool) []V {")
+	buff.WriteString("\n\tvar rows []V")
+	buff.WriteString("\n\tfor _, v := range t.rows {")
+	buff.WriteString("\n\t\tif fn(v) {")
+	buff.WriteString("\n\t\t\trows = append(rows, v)")
+	buff.WriteString("\n\t\t}")
+	buff.WriteString("\n\t}")
+	buff.WriteString("\n\treturn rows")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// put 添加数据行, 主键已经存在时在原来的位置替换, 返回主键是否已经存在")
+	buff.WriteString("\nfunc (t *Table[K, V]) put(v V) bool {")
+	buff.WriteString("\n\tk := t.key(v)")
+	buff.WriteString("\n\tif i, ok := t.pos[k]; ok {")
+	buff.WriteString("\n\t\tt.rows[i] = v")
+	buff.WriteString("\n\t\treturn true")
+	buff.WriteString("\n\t}")
+	buff.WriteString("\n\tt.pos[k] = len(t.rows)")
+	buff.WriteString("\n\tt.rows = append(t.rows, v)")
+	buff.WriteString("\n\treturn false")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// Index 二级索引, 同一索引值的数据行按表格中的顺序排列")
+	buff.WriteString("\ntype Index[I comparable, V any] struct {")
+	buff.WriteString("\n\trows map[I][]V")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// NewIndex 按key返回的索引值构建配置表的二级索引, 配置表重新加载后需要重新构建,")
+	buff.WriteString("\n// 如: NewIndex(s.ItemTable, func(r *ItemStruct) ItemTypeEnum { return r.Type })")
+	buff.WriteString("\nfunc NewIndex[I comparable, K comparable, V any](t *Table[K, V], key func(V) I) *Index[I, V] {")
+	buff.WriteString("\n\tx := &Index[I, V]{rows: make(map[I][]V)}")
+	buff.WriteString("\n\tfor _, v := range t.rows {")
+	buff.WriteString("\n\t\ti := key(v)")
+	buff.WriteString("\n\t\tx.rows[i] = append(x.rows[i], v)")
+	buff.WriteString("\n\t}")
+	buff.WriteString("\n\treturn x")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// Get 按索引值查找全部数据行")
+	buff.WriteString("\nfunc (x *Index[I, V]) Get(i I) []V {")
+	buff.WriteString("\n\treturn x.rows[i]")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// First 按索引值查找第一条数据行")
+	buff.WriteString("\nfunc (x *Index[I, V]) First(i I) (v V, ok bool) {")
+	buff.WriteString("\n\tif rows := x.rows[i]; len(rows) > 0 {")
+	buff.WriteString("\n\t\treturn rows[0], true")
+	buff.WriteString("\n\t}")
+	buff.WriteString("\n\treturn v, false")
+	buff.WriteString("\n}")
+	buff.WriteString("\n")
+	return buff.String()
+}
+
+// genRegistry 生成配置注册表, 全部数据加载到不可修改的快照中, 重新加载时原子替换
+func (gen *GoGen) genRegistry() string {
+	names := gen.cfgMap.GetDataNames()
+	if len(names) == 0 {
+		return ""
+	}
+
+	var buff bytes.Buffer
+	buff.WriteString("// Code generated by game config export tool. DO NOT EDIT.")
+	buff.WriteString("\npackage " + packageName)
+	buff.WriteString("\n\nimport (")
+	buff.WriteString("\n\t\"errors\"")
+	buff.WriteString("\n\t\"fmt\"")
+	buff.WriteString("\n\t\"io/fs\"")
+	buff.WriteString("\n\t\"os\"")
+	buff.WriteString("\n\t\"sync\"")
+	buff.WriteString("\n\t\"sync/atomic\"")
+	buff.WriteString("\n)")
+
+	buff.WriteString("\n\n// Snapshot 全部配置数据的快照, 加载完成后不再修改, 可以在多个goroutine中同时读取")
+	buff.WriteString("\ntype Snapshot struct {")
+	buff.WriteString("\n\t// Version 版本号, 每次加载成功后递增")
+	buff.WriteString("\n\tVersion uint64")
+	for _, name := range names {
+		tableDef := gen.cfgMap.TableMap[name]
+		buff.WriteString("\n\t// " + name + " " + tableDef.Desc)
+		if strings.HasSuffix(name, "Table") {
+			keyField := tableDef.Fields[tableDef.Key]
+			buff.WriteString("\n\t" + name + " *Table[" + getTypeName(keyField) + ", *" + genStructName(name) + "]")
+		} else {
+			buff.WriteString("\n\t" + name + " *" + genStructName(name))
+		}
+	}
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// relate 关联快照中的全部数据")
+	buff.WriteString("\nfunc (s *Snapshot) relate() error {")
+	if cfgdef.ExportFlags.BackRefs {
+		//重新关联时先清除反向引用, 避免重复收集
+		for _, name := range names {
+			if strings.HasSuffix(name, "Table") && gen.cfgMap.IsReferenced(name) {
+				buff.WriteString("\n\tfor _, r := range s." + name + ".All() {")
+				buff.WriteString("\n\t\tr.referencedBy = nil")
+				buff.WriteString("\n\t}")
+			}
+		}
+	}
+	buff.WriteString("\n\tvar errs []error")
+	for _, name := range names {
+		if !gen.cfgMap.NeedRelate(name) {
+			continue
+		}
+		if strings.HasSuffix(name, "Table") {
+			buff.WriteString("\n\tfor _, r := range s." + name + ".All() {")
+			buff.WriteString("\n\t\terrs = append(errs, r.RelateIn(s))")
+			buff.WriteString("\n\t}")
+		} else {
+			buff.WriteString("\n\terrs = append(errs, s." + name + ".RelateIn(s))")
+		}
+	}
+	buff.WriteString("\n\treturn errors.Join(errs...)")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// globalSnapshot 全局数据组成的快照, 用于全局数据的关联")
+	buff.WriteString("\nfunc globalSnapshot() *Snapshot {")
+	buff.WriteString("\n\treturn &Snapshot{")
+	width := 0
+	for _, name := range names {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	for _, name := range names {
+		pad := strings.Repeat(" ", width-len(name))
+		if strings.HasSuffix(name, "Table") {
+			buff.WriteString("\n\t\t" + name + ": " + pad + name + ",")
+		} else {
+			buff.WriteString("\n\t\t" + name + ": " + pad + "&" + name + ",")
+		}
+	}
+	buff.WriteString("\n\t}")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// Registry 配置注册表, 重新加载时在新的快照中解析和关联, 全部成功后原子替换当前快照,")
+	buff.WriteString("\n// 读取当前快照不需要加锁")
+	buff.WriteString("\ntype Registry struct {")
+	buff.WriteString("\n\tcurrent     atomic.Value // *Snapshot")
+	buff.WriteString("\n\tmu          sync.Mutex")
+	buff.WriteString("\n\tversion     uint64")
+	buff.WriteString("\n\tsubscribers []func(*Snapshot)")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// NewRegistry 构建配置注册表")
+	buff.WriteString("\nfunc NewRegistry() *Registry {")
+	buff.WriteString("\n\treturn &Registry{}")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// Current 当前快照, 没有加载成功过时返回nil")
+	buff.WriteString("\nfunc (r *Registry) Current() *Snapshot {")
+	buff.WriteString("\n\ts, _ := r.current.Load().(*Snapshot)")
+	buff.WriteString("\n\treturn s")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// Subscribe 订阅快照更新, 每次加载成功后以新的快照调用")
+	buff.WriteString("\nfunc (r *Registry) Subscribe(fn func(*Snapshot)) {")
+	buff.WriteString("\n\tr.mu.Lock()")
+	buff.WriteString("\n\tr.subscribers = append(r.subscribers, fn)")
+	buff.WriteString("\n\tr.mu.Unlock()")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// Load 从目录加载全部配置数据, 解析或者关联失败时保留当前快照并返回全部错误")
+	buff.WriteString("\nfunc (r *Registry) Load(dir string) error {")
+	buff.WriteString("\n\treturn r.LoadFS(os.DirFS(dir))")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// parseSnapshot 从文件系统解析全部配置数据到新的快照, 不修改全局数据和当前快照")
+	buff.WriteString("\nfunc parseSnapshot(fsys fs.FS, version uint64) (*Snapshot, error) {")
+	buff.WriteString("\n\ts := &Snapshot{Version: version}")
+	buff.WriteString("\n\tvar errs []error")
+	buff.WriteString("\n\tvar data []byte")
+	buff.WriteString("\n\tvar err error")
+	for _, name := range names {
+		buff.WriteString("\n\tif data, err = fs.ReadFile(fsys, \"" + name + ".json\"); err == nil {")
+		buff.WriteString("\n\t\ts." + name + ", err = " + name + "Parse(data)")
+		buff.WriteString("\n\t}")
+		buff.WriteString("\n\tif err != nil {")
+		buff.WriteString("\n\t\terrs = append(errs, fmt.Errorf(\"" + name + ": %w\", err))")
+		buff.WriteString("\n\t}")
+	}
+	buff.WriteString("\n\tif err := errors.Join(errs...); err != nil {")
+	buff.WriteString("\n\t\treturn nil, err")
+	buff.WriteString("\n\t}")
+	buff.WriteString("\n\treturn s, nil")
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// LoadFS 从文件系统加载全部配置数据, 如: embed.FS, 解析或者关联失败时保留当前快照并返回全部错误")
+	buff.WriteString("\nfunc (r *Registry) LoadFS(fsys fs.FS) error {")
+	buff.WriteString("\n\tr.mu.Lock()")
+	buff.WriteString("\n\ts, err := parseSnapshot(fsys, r.version+1)")
+	buff.WriteString("\n\tif err == nil {")
+	buff.WriteString("\n\t\terr = s.relate()")
+	buff.WriteString("\n\t}")
+	buff.WriteString("\n\tif err != nil {")
+	buff.WriteString("\n\t\tr.mu.Unlock()")
+	buff.WriteString("\n\t\treturn err")
+	buff.WriteString("\n\t}")
+	buff.WriteString("\n\tr.version = s.Version")
+	buff.WriteString("\n\tr.current.Store(s)")
+	buff.WriteString("\n\tsubscribers := r.subscribers")
+	buff.WriteString("\n\tr.mu.Unlock()")
+	buff.WriteString("\n")
+	buff.WriteString("\n\t//在锁外通知, 订阅者中可以再订阅或者读取当前快照")
+	buff.WriteString("\n\tfor _, fn := range subscribers {")
+	buff.WriteString("\n\t\tfn(s)")
+	buff.WriteString("\n\t}")
+	buff.WriteString("\n\treturn nil")
+	buff.WriteString("\n}")
+	buff.WriteString("\n")
+	return buff.String()
+}
+
 // GenEnum 生成枚举
 func (gen *GoGen) GenEnum(name string) string {
 	enumDef := gen.cfgMap.EnumMap[name]
 	if enumDef == nil || len(enumDef.Items) == 0 {
-		fmt.Println("error: ", name, "定义无效")
+		cfgdef.Error(name, "定义无效")
 		return ""
 	}
 	var buff bytes.Buffer
 	buff.WriteString("// Code generated by game config export tool. DO NOT EDIT.")
 	buff.WriteString("\npackage " + packageName)
 	buff.WriteString("\n\n// " + name + " " + enumDef.Desc)
-	buff.WriteString("\ntype " + name + " int")
+	if enumDef.Type != "" {
+		buff.WriteString("\ntype " + name + " " + enumDef.Type)
+	} else {
+		buff.WriteString("\ntype " + name + " int")
+	}
 	buff.WriteString("\n\nconst (")
-	name2 := name[:len(name)-4]
+	name2 := cfgdef.GetEnumBaseName(name)
 	for i := 0; i < len(enumDef.Items); i++ {
 		item := enumDef.Items[i]
 		buff.WriteString("\n\t// " + name2 + item.Name + " " + item.Desc)
 		buff.WriteString("\n\t" + name2 + item.Name + " " + name + " = " + item.Value)
 	}
 	buff.WriteString("\n)")
+	if enumDef.IsFlags {
+		buff.WriteString("\n\n// Has 是否包含flags中的全部标记")
+		buff.WriteString("\nfunc (f " + name + ") Has(flags " + name + ") bool {")
+		buff.WriteString("\n\treturn f&flags == flags")
+		buff.WriteString("\n}")
+		buff.WriteString("\n\n// Any 是否包含flags中的任意标记")
+		buff.WriteString("\nfunc (f " + name + ") Any(flags " + name + ") bool {")
+		buff.WriteString("\n\treturn f&flags != 0")
+		buff.WriteString("\n}")
+		buff.WriteString("\n\n// Set 添加标记")
+		buff.WriteString("\nfunc (f " + name + ") Set(flags " + name + ") " + name + " {")
+		buff.WriteString("\n\treturn f | flags")
+		buff.WriteString("\n}")
+		buff.WriteString("\n\n// Clear 去掉标记")
+		buff.WriteString("\nfunc (f " + name + ") Clear(flags " + name + ") " + name + " {")
+		buff.WriteString("\n\treturn f &^ flags")
+		buff.WriteString("\n}")
+	}
+	buff.WriteString("\n")
+	return buff.String()
+}
+
+// GenUnion 生成联合体
+func (gen *GoGen) GenUnion(name string) string {
+	unionDef := gen.cfgMap.UnionMap[name]
+	if unionDef == nil || len(unionDef.Items) == 0 {
+		cfgdef.Error(name, "定义无效")
+		return ""
+	}
+	baseName := name[:len(name)-5]
+	enumName := unionDef.Enum[:len(unionDef.Enum)-4]
+	valueName := baseName + "Variant"
+	var buff bytes.Buffer
+	buff.WriteString("// Code generated by game config export tool. DO NOT EDIT.")
+	buff.WriteString("\npackage " + packageName)
+	buff.WriteString("\n\nimport (")
+	buff.WriteString("\n\t\"encoding/json\"")
+	buff.WriteString("\n\t\"fmt\"")
+	buff.WriteString("\n)")
+	buff.WriteString("\n\n// " + valueName + " " + name + "的数据, 由以下结构体实现:")
+	done := make(map[string]bool)
+	for i := 0; i < len(unionDef.Items); i++ {
+		item := unionDef.Items[i]
+		if item.Struct != "" && !done[item.Struct] {
+			buff.WriteString("\n//   *" + item.Struct)
+			done[item.Struct] = true
+		}
+	}
+	buff.WriteString("\ntype " + valueName + " interface {")
+	buff.WriteString("\n\tis" + name + "()")
+	buff.WriteString("\n}")
+	done = make(map[string]bool)
+	for i := 0; i < len(unionDef.Items); i++ {
+		item := unionDef.Items[i]
+		if item.Struct != "" && !done[item.Struct] {
+			buff.WriteString("\n\nfunc (*" + item.Struct + ") is" + name + "() {}")
+			done[item.Struct] = true
+		}
+	}
+
+	buff.WriteString("\n\n// " + name + " " + unionDef.Desc)
+	buff.WriteString("\ntype " + name + " struct {")
+	buff.WriteString("\n\t// Type 类型")
+	buff.WriteString("\n\tType " + unionDef.Enum)
+	buff.WriteString("\n\t// Data 数据, 类型为Type对应的结构体指针, 没有数据时为nil")
+	buff.WriteString("\n\tData " + valueName)
+	buff.WriteString("\n}")
+
+	buff.WriteString("\n\n// UnmarshalJSON 根据Type解析Data")
+	buff.WriteString("\nfunc (r *" + name + ") UnmarshalJSON(s []byte) error {")
+	buff.WriteString("\n\tvar raw struct {")
+	buff.WriteString("\n\t\tType " + unionDef.Enum)
+	buff.WriteString("\n\t\tData json.RawMessage")
+	buff.WriteString("\n\t}")
+	buff.WriteString("\n\tif err := json.Unmarshal(s, &raw); err != nil {")
+	buff.WriteString("\n\t\treturn err")
+	buff.WriteString("\n\t}")
+	buff.WriteString("\n\tr.Type = raw.Type")
+	buff.WriteString("\n\tswitch raw.Type {")
+	for i := 0; i < len(unionDef.Items); i++ {
+		item := unionDef.Items[i]
+		buff.WriteString("\n\tcase " + enumName + item.Name + ":")
+		if item.Struct != "" {
+			buff.WriteString("\n\t\tr.Data = &" + item.Struct + "{}")
+		} else {
+			buff.WriteString("\n\t\tr.Data = nil")
+			buff.WriteString("\n\t\treturn nil")
+		}
+	}
+	buff.WriteString("\n\tdefault:")
+	buff.WriteString("\n\t\treturn fmt.Errorf(\"" + name + ": unknown type %d\", raw.Type)")
+	buff.WriteString("\n\t}")
+	buff.WriteString("\n\tif len(raw.Data) == 0 || string(raw.Data) == \"null\" {")
+	buff.WriteString("\n\t\treturn nil")
+	buff.WriteString("\n\t}")
+	buff.WriteString("\n\treturn json.Unmarshal(raw.Data, r.Data)")
+	buff.WriteString("\n}")
+
+	if gen.cfgMap.NeedRelate(name) {
+		buff.WriteString("\n\n// RelateIn 在快照中关联当前数据的父子表, 返回全部找不到的关联")
+		buff.WriteString("\nfunc (r *" + name + ") RelateIn(s *Snapshot) error {")
+		buff.WriteString("\n\tswitch d := r.Data.(type) {")
+		done = make(map[string]bool)
+		for i := 0; i < len(unionDef.Items); i++ {
+			item := unionDef.Items[i]
+			if item.Struct != "" && !done[item.Struct] && gen.cfgMap.NeedRelate(item.Struct) {
+				buff.WriteString("\n\tcase *" + item.Struct + ":")
+				buff.WriteString("\n\t\treturn d.RelateIn(s)")
+				done[item.Struct] = true
+			}
+		}
+		buff.WriteString("\n\t}")
+		buff.WriteString("\n\treturn nil")
+		buff.WriteString("\n}")
+	}
+	buff.WriteString("\n")
 	return buff.String()
 }
 
@@ -69,7 +773,7 @@ func (gen *GoGen) GenEnum(name string) string {
 func (gen *GoGen) GenTable(name string) string {
 	tableDef := gen.cfgMap.TableMap[name]
 	if tableDef == nil || len(tableDef.Fields) == 0 {
-		fmt.Println("error: ", name, "定义无效")
+		cfgdef.Error(name, "定义无效")
 		return ""
 	}
 
@@ -80,11 +784,30 @@ func (gen *GoGen) GenTable(name string) string {
 	var buff bytes.Buffer
 	var buff2 bytes.Buffer
 
+	//关联失败时的错误信息中的数据行, 如: ItemTable[1001]
+	rowName, rowArg := name, ""
+	if isTable {
+		rowName, rowArg = name+"[%v]", "r."+tableDef.Fields[tableDef.Key].Name+", "
+	}
+	hasRelate := gen.cfgMap.NeedRelate(name)
+	hasFTable := false
+
 	buff.WriteString("// Code generated by game config export tool. DO NOT EDIT.")
 	buff.WriteString("\npackage " + packageName)
 	buff.WriteString("\n\nimport (")
+	if isTable || isSettings {
+		buff.WriteString("\n\t\"bytes\"")
+	}
 	buff.WriteString("\n\t\"encoding/json\"")
-	buff.WriteString("\n\t\"log\"")
+	if hasRelate {
+		buff.WriteString("\n\t\"errors\"")
+	}
+	if hasRelate || isTable || isSettings {
+		buff.WriteString("\n\t\"fmt\"")
+	}
+	if isTable || isSettings {
+		buff.WriteString("\n\t\"io\"")
+	}
 	buff.WriteString("\n)")
 	buff.WriteString("\n\n// " + structName + " " + tableDef.Desc)
 	buff.WriteString("\ntype " + structName + " struct {")
@@ -93,89 +816,194 @@ func (gen *GoGen) GenTable(name string) string {
 		if field.Name != "" && field.Type != "" &&
 			(field.IsKey || field.UseFor == "A" || field.UseFor == cfgdef.ExportFlags.UseFor) {
 			buff.WriteString("\n\t// " + field.Name + " " + field.Desc)
-			buff.WriteString("\n\t" + field.Name + " " + genType(field.Type, field.IsArray))
-			if field.FTable != "" {
-				relateName := field.Name + "2" + field.FTable
-				buff.WriteString("\n\t// " + relateName + " " + field.Name + "关联的" + field.FTable)
-				buff.WriteString("\n\t" + relateName + " " + cfgdef.GetArraySymbol(field.IsArray) + "*" + field.FTable + "Struct `json:\"-\"`")
+			buff.WriteString("\n\t" + field.Name + " " + genType(getTypeName(field), field.IsArray))
+			if (field.IsStruct || field.IsUnion) && gen.cfgMap.NeedRelate(field.Type) {
+				//嵌套的结构体和联合体中的关联, 错误信息加上所在的字段
+				if field.IsArray {
+					buff2.WriteString("\n\tfor i := range r." + field.Name + " {")
+					buff2.WriteString("\n\t\tif err := r." + field.Name + "[i].RelateIn(s); err != nil {")
+					buff2.WriteString("\n\t\t\terrs = append(errs, fmt.Errorf(\"" + rowName + "." + field.Name + "[%d]: %w\", " + rowArg + "i, err))")
+					buff2.WriteString("\n\t\t}")
+					buff2.WriteString("\n\t}")
+				} else {
+					buff2.WriteString("\n\tif err := r." + field.Name + ".RelateIn(s); err != nil {")
+					buff2.WriteString("\n\t\terrs = append(errs, fmt.Errorf(\"" + rowName + "." + field.Name + ": %w\", " + rowArg + "err))")
+					buff2.WriteString("\n\t}")
+				}
+			}
+			if ftable := gen.cfgMap.GetRelateTable(field.FTable); ftable != "" {
+				hasFTable = true
+				relateName := field.Name + "2" + ftable
+				//0和空字符串表示没有关联
+				zero := "0"
+				if field.Type == "string" {
+					zero = `""`
+				}
+				buff.WriteString("\n\t// " + relateName + " " + field.Name + "关联的" + ftable)
+				buff.WriteString("\n\t" + relateName + " " + cfgdef.GetArraySymbol(field.IsArray) + "*" + ftable + "Struct `json:\"-\"`")
 				if field.IsArray {
-					buff2.WriteString("\n\tr." + relateName + " = make([]*" + field.FTable + "Struct, len(r." + field.Name + "))")
+					buff2.WriteString("\n\tr." + relateName + " = make([]*" + ftable + "Struct, len(r." + field.Name + "))")
 					buff2.WriteString("\n\tfor i := 0; i < len(r." + field.Name + "); i++ {")
-					buff2.WriteString("\n\t\tr." + relateName + "[i], ok = " + field.FTable + "Table[r." + field.Name + "[i]]")
-					buff2.WriteString("\n\t\tif !ok {")
-					buff2.WriteString("\n\t\t\tlog.Println(\"error: can't find " + field.FTable + ":\", r." + field.Name + "[i])")
+					buff2.WriteString("\n\t\tr." + relateName + "[i], ok = s." + ftable + "Table.Get(r." + field.Name + "[i])")
+					buff2.WriteString("\n\t\tif !ok && r." + field.Name + "[i] != " + zero + " {")
+					buff2.WriteString("\n\t\t\terrs = append(errs, fmt.Errorf(\"" + rowName + "." + field.Name + "[%d]: can't find " + ftable + " %v\", " + rowArg + "i, r." + field.Name + "[i]))")
+					if cfgdef.ExportFlags.BackRefs {
+						buff2.WriteString("\n\t\t} else if ok {")
+						buff2.WriteString("\n\t\t\tr." + relateName + "[i].referencedBy = append(r." + relateName + "[i].referencedBy, CfgRef{Table: \"" + name + "\", Field: \"" + field.Name + "\", Row: r})")
+					}
 					buff2.WriteString("\n\t\t}")
 					buff2.WriteString("\n\t}")
 				} else {
-					buff2.WriteString("\n\tr." + relateName + ", ok = " + field.FTable + "Table[r." + field.Name + "]")
-					buff2.WriteString("\n\tif !ok {")
-					buff2.WriteString("\n\t\tlog.Println(\"error: can't find " + field.FTable + ":\", r." + field.Name + ")")
+					buff2.WriteString("\n\tr." + relateName + ", ok = s." + ftable + "Table.Get(r." + field.Name + ")")
+					buff2.WriteString("\n\tif !ok && r." + field.Name + " != " + zero + " {")
+					buff2.WriteString("\n\t\terrs = append(errs, fmt.Errorf(\"" + rowName + "." + field.Name + ": can't find " + ftable + " %v\", " + rowArg + "r." + field.Name + "))")
+					if cfgdef.ExportFlags.BackRefs {
+						buff2.WriteString("\n\t} else if ok {")
+						buff2.WriteString("\n\t\tr." + relateName + ".referencedBy = append(r." + relateName + ".referencedBy, CfgRef{Table: \"" + name + "\", Field: \"" + field.Name + "\", Row: r})")
+					}
 					buff2.WriteString("\n\t}")
 				}
 			}
 		}
 	}
+	isReferenced := isTable && cfgdef.ExportFlags.BackRefs && gen.cfgMap.IsReferenced(name)
+	if isReferenced {
+		buff.WriteString("\n\t// referencedBy 引用该数据行的数据行, 关联时收集")
+		buff.WriteString("\n\treferencedBy []CfgRef")
+	}
 	buff.WriteString("\n}")
+	if isReferenced {
+		buff.WriteString("\n\n// ReferencedBy 引用该数据行的数据行, 各表关联(Relate)后可用")
+		buff.WriteString("\nfunc (r *" + structName + ") ReferencedBy() []CfgRef {")
+		buff.WriteString("\n\treturn r.referencedBy")
+		buff.WriteString("\n}")
+	}
 	if isTable {
 		keyField := tableDef.Fields[tableDef.Key]
 		buff.WriteString("\n\n// " + name + " " + tableDef.Desc)
-		buff.WriteString("\nvar " + name + " = make(map[" + keyField.Type + "]*" + structName + ")")
+		buff.WriteString("\nvar " + name + " = NewTable((*" + structName + ").tableKey)")
+
+		buff.WriteString("\n\n// tableKey 主键")
+		buff.WriteString("\nfunc (r *" + structName + ") tableKey() " + getTypeName(keyField) + " {")
+		buff.WriteString("\n\treturn r." + keyField.Name)
+		buff.WriteString("\n}")
 	} else if isSettings {
 		buff.WriteString("\n\n// " + name + " " + tableDef.Desc)
 		buff.WriteString("\nvar " + name + " " + structName)
 	}
 
-	buff.WriteString("\n\n// Unmarshal Unmarshal")
-	buff.WriteString("\nfunc (r " + structName + ") Unmarshal(s []byte) error {")
-	buff.WriteString("\n\terr := json.Unmarshal(s, &r)")
-	buff.WriteString("\n\tif err != nil {")
-	buff.WriteString("\n\t\tlog.Println(\"error:\", err)")
-	buff.WriteString("\n\t}")
-	buff.WriteString("\n\treturn err")
+	buff.WriteString("\n\n// Unmarshal 解析一行数据")
+	buff.WriteString("\nfunc (r *" + structName + ") Unmarshal(s []byte) error {")
+	buff.WriteString("\n\treturn json.Unmarshal(s, r)")
 	buff.WriteString("\n}")
 
-	if buff2.Len() > 0 {
-		buff.WriteString("\n\n// Relate 父子表关联")
-		buff.WriteString("\nfunc (r *" + structName + ") Relate() {")
-		buff.WriteString("\n\tvar ok bool")
+	if hasRelate {
+		buff.WriteString("\n\n// RelateIn 在快照中关联父子表, 返回全部找不到的关联")
+		buff.WriteString("\nfunc (r *" + structName + ") RelateIn(s *Snapshot) error {")
+		buff.WriteString("\n\tvar errs []error")
+		if hasFTable {
+			buff.WriteString("\n\tvar ok bool")
+		}
 		buff.WriteString(buff2.String())
+		buff.WriteString("\n\treturn errors.Join(errs...)")
+		buff.WriteString("\n}")
+
+		buff.WriteString("\n\n// Relate 使用全局数据关联父子表, 返回全部找不到的关联")
+		buff.WriteString("\nfunc (r *" + structName + ") Relate() error {")
+		buff.WriteString("\n\treturn r.RelateIn(globalSnapshot())")
 		buff.WriteString("\n}")
 	}
 
 	if isTable {
 		keyField := tableDef.Fields[tableDef.Key]
-		buff.WriteString("\n\n// " + name + "Load 数据加载")
-		buff.WriteString("\nfunc " + name + "Load(s []byte) {")
+		tableType := "*Table[" + getTypeName(keyField) + ", *" + structName + "]"
+		buff.WriteString("\n\n// " + name + "Decode 从io.Reader解析数据, 不修改全局数据, 主键重复时返回错误")
+		buff.WriteString("\nfunc " + name + "Decode(rd io.Reader) (" + tableType + ", error) {")
 		buff.WriteString("\n\tvar data []*" + structName)
-		buff.WriteString("\n\terr := json.Unmarshal(s, &data)")
-		buff.WriteString("\n\tif err != nil {")
-		buff.WriteString("\n\t\tlog.Println(\"error:\", err)")
-		buff.WriteString("\n\t\treturn")
+		buff.WriteString("\n\tif err := json.NewDecoder(rd).Decode(&data); err != nil {")
+		buff.WriteString("\n\t\treturn nil, err")
 		buff.WriteString("\n\t}")
+		buff.WriteString("\n\tt := NewTable((*" + structName + ").tableKey)")
 		buff.WriteString("\n\tfor _, row := range data {")
-		buff.WriteString("\n\t\t_, ok := " + name + "[row." + keyField.Name + "]")
-		buff.WriteString("\n\t\tif ok {")
-		buff.WriteString("\n\t\t\tlog.Println(\"" + name + " replace:\", row)")
+		buff.WriteString("\n\t\tif t.put(row) {")
+		buff.WriteString("\n\t\t\treturn nil, fmt.Errorf(\"duplicate key %v\", row." + keyField.Name + ")")
 		buff.WriteString("\n\t\t}")
-		buff.WriteString("\n\t\t" + name + "[row." + keyField.Name + "] = row")
 		buff.WriteString("\n\t}")
+		buff.WriteString("\n\treturn t, nil")
+		buff.WriteString("\n}")
+
+		buff.WriteString("\n\n// " + name + "Parse 解析数据, 不修改全局数据, 主键重复时返回错误")
+		buff.WriteString("\nfunc " + name + "Parse(s []byte) (" + tableType + ", error) {")
+		buff.WriteString("\n\treturn " + name + "Decode(bytes.NewReader(s))")
 		buff.WriteString("\n}")
 
-		buff.WriteString("\n\n// " + name + "Relate 父子表关联")
-		buff.WriteString("\nfunc " + name + "Relate() {")
-		if buff2.Len() > 0 {
-			buff.WriteString("\n\tfor _, r := range " + name + " {")
-			buff.WriteString("\n\t\tr.Relate()")
+		buff.WriteString("\n\n// " + name + "LoadFrom 从io.Reader加载数据, 解析成功后合并到全局数据, 主键相同的数据行被替换")
+		buff.WriteString("\nfunc " + name + "LoadFrom(rd io.Reader) error {")
+		buff.WriteString("\n\tt, err := " + name + "Decode(rd)")
+		buff.WriteString("\n\tif err != nil {")
+		buff.WriteString("\n\t\treturn fmt.Errorf(\"" + name + ": %w\", err)")
+		buff.WriteString("\n\t}")
+		buff.WriteString("\n\tfor _, row := range t.All() {")
+		buff.WriteString("\n\t\t" + name + ".put(row)")
+		buff.WriteString("\n\t}")
+		buff.WriteString("\n\treturn nil")
+		buff.WriteString("\n}")
+
+		buff.WriteString("\n\n// " + name + "Load 数据加载")
+		buff.WriteString("\nfunc " + name + "Load(s []byte) error {")
+		buff.WriteString("\n\treturn " + name + "LoadFrom(bytes.NewReader(s))")
+		buff.WriteString("\n}")
+
+		buff.WriteString("\n\n// " + name + "Relate 父子表关联, 返回全部找不到的关联")
+		buff.WriteString("\nfunc " + name + "Relate() error {")
+		if hasRelate {
+			buff.WriteString("\n\ts := globalSnapshot()")
+			buff.WriteString("\n\tvar errs []error")
+			buff.WriteString("\n\tfor _, r := range " + name + ".All() {")
+			buff.WriteString("\n\t\terrs = append(errs, r.RelateIn(s))")
 			buff.WriteString("\n\t}")
+			buff.WriteString("\n\treturn errors.Join(errs...)")
+		} else {
+			buff.WriteString("\n\treturn nil")
 		}
 		buff.WriteString("\n}")
 	} else if isSettings {
-		buff.WriteString("\n\n// " + name + "Load 数据加载")
-		buff.WriteString("\nfunc " + name + "Load(s []byte) {")
-		buff.WriteString("\n\terr := json.Unmarshal(s, &" + name + ")")
+		buff.WriteString("\n\n// " + name + "Decode 从io.Reader解析数据, 不修改全局数据")
+		buff.WriteString("\nfunc " + name + "Decode(rd io.Reader) (*" + structName + ", error) {")
+		buff.WriteString("\n\tr := new(" + structName + ")")
+		buff.WriteString("\n\tif err := json.NewDecoder(rd).Decode(r); err != nil {")
+		buff.WriteString("\n\t\treturn nil, err")
+		buff.WriteString("\n\t}")
+		buff.WriteString("\n\treturn r, nil")
+		buff.WriteString("\n}")
+
+		buff.WriteString("\n\n// " + name + "Parse 解析数据, 不修改全局数据")
+		buff.WriteString("\nfunc " + name + "Parse(s []byte) (*" + structName + ", error) {")
+		buff.WriteString("\n\treturn " + name + "Decode(bytes.NewReader(s))")
+		buff.WriteString("\n}")
+
+		buff.WriteString("\n\n// " + name + "LoadFrom 从io.Reader加载数据, 解析成功后替换全局数据")
+		buff.WriteString("\nfunc " + name + "LoadFrom(rd io.Reader) error {")
+		buff.WriteString("\n\tr, err := " + name + "Decode(rd)")
 		buff.WriteString("\n\tif err != nil {")
-		buff.WriteString("\n\t\tlog.Println(\"error:\", err)")
+		buff.WriteString("\n\t\treturn fmt.Errorf(\"" + name + ": %w\", err)")
 		buff.WriteString("\n\t}")
+		buff.WriteString("\n\t" + name + " = *r")
+		buff.WriteString("\n\treturn nil")
+		buff.WriteString("\n}")
+
+		buff.WriteString("\n\n// " + name + "Load 数据加载")
+		buff.WriteString("\nfunc " + name + "Load(s []byte) error {")
+		buff.WriteString("\n\treturn " + name + "LoadFrom(bytes.NewReader(s))")
+		buff.WriteString("\n}")
+
+		buff.WriteString("\n\n// " + name + "Relate 父子表关联, 返回全部找不到的关联")
+		buff.WriteString("\nfunc " + name + "Relate() error {")
+		if hasRelate {
+			buff.WriteString("\n\treturn " + name + ".Relate()")
+		} else {
+			buff.WriteString("\n\treturn nil")
+		}
 		buff.WriteString("\n}")
 	}
 	buff.WriteString("\n")
@@ -0,0 +1,184 @@
+package gogen
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/gamewheels/cfgwheel/cfgdef"
+)
+
+// newTable 构建测试用的表格定义
+func newTable(name string, fields ...*cfgdef.FieldDef) *cfgdef.TableDef {
+	tableDef := cfgdef.NewTableDef(name)
+	tableDef.Key = 0
+	for i, field := range fields {
+		field.UseFor = "A"
+		tableDef.Fields[i] = field
+		tableDef.FieldsMap[field.Name] = field
+	}
+	return tableDef
+}
+
+// genModule 生成胶水代码和go.mod到临时目录, 返回目录
+func genModule(t *testing.T, cfgMap *cfgdef.CfgMap, extra map[string]string) string {
+	dir := t.TempDir()
+	gen := NewGoGen(cfgMap)
+	files := gen.GenCommonFiles()
+	for name := range cfgMap.TableMap {
+		files[gen.GenFileName(name)] = gen.GenTable(name)
+	}
+	files["go.mod"] = "module " + packageName + "\n\ngo 1.21\n"
+	for filename, s := range extra {
+		files[filename] = s
+	}
+	for filename, s := range files {
+		if err := os.WriteFile(filepath.Join(dir, filename), []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// runGo 在目录中执行go命令, 没有安装go时跳过测试
+func runGo(t *testing.T, dir string, args ...string) {
+	goPath, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not found")
+	}
+	cmd := exec.Command(goPath, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=", "GOWORK=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go %s: %v\n%s", args[0], err, out)
+	}
+}
+
+// TestGenBuild 生成的代码可以编译, 没有用到公共类型时也要生成表格、注册表和清单
+func TestGenBuild(t *testing.T) {
+	cfgMap := cfgdef.NewCfgMap()
+	cfgMap.TableMap["ItemTable"] = newTable("ItemTable",
+		&cfgdef.FieldDef{Name: "ID", Type: "uint32", IsKey: true},
+		&cfgdef.FieldDef{Name: "Name", Type: "string"})
+	cfgMap.TableMap["ShopTable"] = newTable("ShopTable",
+		&cfgdef.FieldDef{Name: "ID", Type: "uint32", IsKey: true},
+		&cfgdef.FieldDef{Name: "ItemID", Type: "uint32", FTable: "Item"},
+		&cfgdef.FieldDef{Name: "Price", Type: "int32"})
+
+	flags := cfgdef.ExportFlags
+	defer func() { cfgdef.ExportFlags = flags }()
+
+	tests := []struct {
+		name     string
+		backRefs bool
+	}{
+		{"plain", false},
+		{"backrefs", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfgdef.ExportFlags.UseFor = "S"
+			cfgdef.ExportFlags.BackRefs = tt.backRefs
+			cfgdef.ExportFlags.GoEmbed = false
+			runGo(t, genModule(t, cfgMap, nil), "build", "./...")
+		})
+	}
+}
+
+// fixedTest 在生成的代码中运行, 使用math/big计算期望的乘除法结果
+var fixedTest = `package ` + packageName + `
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestFixed(t *testing.T) {
+	values := []int64{1, -1, 3, -7, 1 << FixedBits, 5 << (FixedBits - 1), 123456789, -987654321,
+		1 << 40, -(1 << 40), 1<<62 - 1, -(1 << 62), 1<<63 - 1}
+	one := big.NewInt(1 << FixedBits)
+	for _, a := range values {
+		for _, b := range values {
+			div := new(big.Int).Quo(new(big.Int).Mul(big.NewInt(a), one), big.NewInt(b))
+			if got := Fixed(a).Div(Fixed(b)); div.IsInt64() && int64(got) != div.Int64() {
+				t.Errorf("%d.Div(%d) = %d, want %s", a, b, got, div)
+			}
+			mul := new(big.Int).Rsh(new(big.Int).Mul(big.NewInt(a), big.NewInt(b)), FixedBits)
+			if got := Fixed(a).Mul(Fixed(b)); mul.IsInt64() && int64(got) != mul.Int64() {
+				t.Errorf("%d.Mul(%d) = %d, want %s", a, b, got, mul)
+			}
+		}
+	}
+}
+`
+
+// TestFixedMath 定点数的乘除法使用128位的中间结果, 大的被除数和乘积不会溢出
+func TestFixedMath(t *testing.T) {
+	cfgMap := cfgdef.NewCfgMap()
+	cfgMap.TableMap["ItemTable"] = newTable("ItemTable",
+		&cfgdef.FieldDef{Name: "ID", Type: "uint32", IsKey: true},
+		&cfgdef.FieldDef{Name: "Speed", Type: "fixed"})
+
+	flags := cfgdef.ExportFlags
+	defer func() { cfgdef.ExportFlags = flags }()
+
+	for _, fixedBits := range []uint{16, 32} {
+		t.Run(strconv.FormatUint(uint64(fixedBits), 10), func(t *testing.T) {
+			cfgdef.ExportFlags.UseFor = "S"
+			cfgdef.ExportFlags.FixedBits = fixedBits
+			runGo(t, genModule(t, cfgMap, map[string]string{"fixed_test.go": fixedTest}), "test", ".")
+		})
+	}
+}
+
+// loadTest 在生成的代码中运行, 关联失败时不替换全局数据
+var loadTest = `package ` + packageName + `
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadAllFS(t *testing.T) {
+	good := fstest.MapFS{
+		"ItemTable.json": {Data: []byte(` + "`" + `[{"ID":1,"Name":"a"}]` + "`" + `)},
+		"ShopTable.json": {Data: []byte(` + "`" + `[{"ID":1,"ItemID":1,"Price":10}]` + "`" + `)},
+	}
+	if err := LoadAllFS(good); err != nil {
+		t.Fatal(err)
+	}
+	bad := fstest.MapFS{
+		"ItemTable.json": {Data: []byte(` + "`" + `[{"ID":2,"Name":"b"}]` + "`" + `)},
+		"ShopTable.json": {Data: []byte(` + "`" + `[{"ID":2,"ItemID":1,"Price":20}]` + "`" + `)},
+	}
+	if err := LoadAllFS(bad); err == nil {
+		t.Fatal("LoadAllFS succeeded, want relate error")
+	}
+	if _, ok := ItemTable.Get(1); !ok || ItemTable.Len() != 1 {
+		t.Errorf("ItemTable replaced after relate error")
+	}
+	if shop, ok := ShopTable.Get(1); !ok || shop.Price != 10 || ShopTable.Len() != 1 {
+		t.Errorf("ShopTable replaced after relate error")
+	}
+}
+`
+
+// TestLoadAllFS 关联失败时LoadAllFS保留当前的全局数据
+func TestLoadAllFS(t *testing.T) {
+	cfgMap := cfgdef.NewCfgMap()
+	cfgMap.TableMap["ItemTable"] = newTable("ItemTable",
+		&cfgdef.FieldDef{Name: "ID", Type: "uint32", IsKey: true},
+		&cfgdef.FieldDef{Name: "Name", Type: "string"})
+	cfgMap.TableMap["ShopTable"] = newTable("ShopTable",
+		&cfgdef.FieldDef{Name: "ID", Type: "uint32", IsKey: true},
+		&cfgdef.FieldDef{Name: "ItemID", Type: "uint32", FTable: "Item"},
+		&cfgdef.FieldDef{Name: "Price", Type: "int32"})
+
+	flags := cfgdef.ExportFlags
+	defer func() { cfgdef.ExportFlags = flags }()
+	cfgdef.ExportFlags.UseFor = "S"
+	cfgdef.ExportFlags.GoEmbed = false
+	runGo(t, genModule(t, cfgMap, map[string]string{"load_test.go": loadTest}), "test", ".")
+}
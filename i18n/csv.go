@@ -0,0 +1,88 @@
+package i18n
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+)
+
+// csv文件的列
+var csvHeader = []string{"ID", "Desc", "Source", "Target", "Status"}
+
+// utf8 bom, 便于Excel正确识别编码
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// csvFormat CSV翻译文件, Status列为fuzzy时表示译文需要复核
+type csvFormat struct{}
+
+// Ext 文件扩展名
+func (csvFormat) Ext() string {
+	return "csv"
+}
+
+// Read 读取翻译文件
+func (csvFormat) Read(r io.Reader) ([]*Unit, error) {
+	br := bufio.NewReader(r)
+	if b, err := br.Peek(len(utf8BOM)); err == nil && bytes.Equal(b, utf8BOM) {
+		br.Discard(len(utf8BOM))
+	}
+	reader := csv.NewReader(br)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	//按照表头查找列, 允许翻译人员调整列的顺序
+	cols := make(map[string]int)
+	for i, name := range records[0] {
+		cols[name] = i
+	}
+	for _, name := range []string{"ID", "Source", "Target"} {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("缺少%s列", name)
+		}
+	}
+	get := func(record []string, name string) string {
+		if i, ok := cols[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	var units []*Unit
+	for _, record := range records[1:] {
+		unit := &Unit{
+			ID:     get(record, "ID"),
+			Source: get(record, "Source"),
+			Target: get(record, "Target"),
+			Desc:   get(record, "Desc"),
+			Fuzzy:  get(record, "Status") == "fuzzy",
+		}
+		if unit.ID != "" {
+			units = append(units, unit)
+		}
+	}
+	return units, nil
+}
+
+// Write 写入翻译文件
+func (csvFormat) Write(w io.Writer, srcLang string, lang string, units []*Unit) error {
+	w.Write(utf8BOM)
+	writer := csv.NewWriter(w)
+	writer.Write(csvHeader)
+	for _, unit := range units {
+		status := ""
+		if unit.Fuzzy {
+			status = "fuzzy"
+		}
+		writer.Write([]string{unit.ID, unit.Desc, unit.Source, unit.Target, status})
+	}
+	writer.Flush()
+	return writer.Error()
+}
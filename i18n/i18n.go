@@ -0,0 +1,208 @@
+package i18n
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gamewheels/cfgwheel/cfgdef"
+)
+
+// Unit 翻译单元
+type Unit struct {
+	ID     string // 文本ID
+	Source string // 源语言文本
+	Target string // 译文
+	Desc   string // 翻译时的上下文
+	Fuzzy  bool   // 源语言文本已经修改, 译文需要复核
+}
+
+// Format 翻译文件格式
+type Format interface {
+	// Ext 文件扩展名
+	Ext() string
+	// Read 读取翻译文件
+	Read(r io.Reader) ([]*Unit, error)
+	// Write 写入翻译文件
+	Write(w io.Writer, srcLang string, lang string, units []*Unit) error
+}
+
+// 支持的翻译文件格式
+var formats = map[string]Format{
+	"csv":   csvFormat{},
+	"po":    poFormat{},
+	"xliff": xliffFormat{},
+}
+
+// Exporter 本地化文本导出器
+type Exporter struct {
+	cfgMap *cfgdef.CfgMap
+}
+
+// NewExporter 构建本地化文本导出器
+func NewExporter(cfgMap *cfgdef.CfgMap) *Exporter {
+	return &Exporter{
+		cfgMap: cfgMap,
+	}
+}
+
+// Export 导出各语言的翻译文件, 并合并翻译文件中已有的译文生成各语言的文本包,
+// 第一个语言为源语言, 文件名如: en.po, text.en.json,
+// 文本ID找不到或者源语言文本已经修改时, 使用源语言文本相同的译文
+func (exp *Exporter) Export(dir string) {
+	format, ok := formats[strings.ToLower(cfgdef.ExportFlags.I18NFormat)]
+	if !ok {
+		cfgdef.Error("不支持的翻译文件格式", cfgdef.ExportFlags.I18NFormat)
+		return
+	}
+	var langs []string
+	for _, lang := range strings.Split(cfgdef.ExportFlags.Langs, ",") {
+		if lang = cfgdef.Trim(lang); lang != "" {
+			langs = append(langs, lang)
+		}
+	}
+	if len(langs) == 0 {
+		cfgdef.Error("没有指定语言")
+		return
+	}
+
+	//按照数据来源排序, 保证每次导出的顺序一致
+	texts := make([]*cfgdef.TextItem, len(exp.cfgMap.Texts))
+	copy(texts, exp.cfgMap.Texts)
+	sort.SliceStable(texts, func(i, j int) bool {
+		a, b := texts[i].Pos, texts[j].Pos
+		if a == nil || b == nil {
+			return a != nil
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Sheet != b.Sheet {
+			return a.Sheet < b.Sheet
+		}
+		return a.Row < b.Row
+	})
+
+	srcLang := langs[0]
+	units := make([]*Unit, len(texts))
+	for i, item := range texts {
+		units[i] = &Unit{ID: item.ID, Source: item.Text, Target: item.Text, Desc: item.Desc}
+	}
+	fmt.Println("生成:", srcLang, "文本包 ...")
+	writeBundle(dir+"/text."+srcLang+".json", units)
+
+	for _, lang := range langs[1:] {
+		filename := dir + "/" + lang + "." + format.Ext()
+		old, err := readUnits(filename, format)
+		if err != nil {
+			//不能覆盖翻译文件, 否则会丢失译文
+			cfgdef.Error("读取翻译文件失败", filename, err)
+			continue
+		}
+
+		bySource := make(map[string]*Unit)
+		for _, o := range old {
+			if o.Target == "" {
+				continue
+			}
+			//源语言文本相同时优先使用不需要复核的译文, 其次按文本ID排序, 保证每次导出的结果一致
+			if s := bySource[o.Source]; s == nil || s.Fuzzy && !o.Fuzzy || s.Fuzzy == o.Fuzzy && o.ID < s.ID {
+				bySource[o.Source] = o
+			}
+		}
+
+		missing, fuzzy := 0, 0
+		units := make([]*Unit, len(texts))
+		for i, item := range texts {
+			unit := &Unit{ID: item.ID, Source: item.Text, Desc: item.Desc}
+			o := old[item.ID]
+			if o == nil || o.Source != item.Text {
+				//数组元素的文本ID使用下标, 插入或者删除元素后按源语言文本查找原来的译文
+				if s := bySource[item.Text]; s != nil {
+					o = s
+				}
+			}
+			if o != nil && o.Target != "" {
+				unit.Target = o.Target
+				unit.Fuzzy = o.Fuzzy || o.Source != item.Text
+			}
+			if unit.Target == "" {
+				missing++
+			} else if unit.Fuzzy {
+				fuzzy++
+			}
+			units[i] = unit
+		}
+
+		fmt.Println("生成:", filename, "...")
+		var buff bytes.Buffer
+		if err := format.Write(&buff, srcLang, lang, units); err != nil {
+			cfgdef.Error(filename, err)
+			continue
+		}
+		if err := os.WriteFile(filename, buff.Bytes(), 0644); err != nil {
+			cfgdef.Error(err)
+			continue
+		}
+
+		//未翻译或者需要复核的文本使用源语言文本
+		bundle := make([]*Unit, len(units))
+		for i, unit := range units {
+			bundle[i] = &Unit{ID: unit.ID, Target: unit.Target}
+			if unit.Target == "" || unit.Fuzzy {
+				bundle[i].Target = unit.Source
+			}
+		}
+		fmt.Println("生成:", lang, "文本包 ...")
+		writeBundle(dir+"/text."+lang+".json", bundle)
+		fmt.Printf("%s: 共%d条文本, 未翻译%d条, 待复核%d条\n", lang, len(units), missing, fuzzy)
+	}
+}
+
+// 读取已有的翻译文件, 文件不存在时返回空
+func readUnits(filename string, format Format) (map[string]*Unit, error) {
+	m := make(map[string]*Unit)
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	units, err := format.Read(f)
+	if err != nil {
+		return nil, err
+	}
+	for _, unit := range units {
+		m[unit.ID] = unit
+	}
+	return m, nil
+}
+
+// 生成文本包, 格式为 {"文本ID":"文本"}, 每行一条文本便于比较差异
+func writeBundle(filename string, units []*Unit) {
+	var buff bytes.Buffer
+	buff.WriteString("{")
+	sp := "\n"
+	for _, unit := range units {
+		buff.WriteString(sp + toJSONString(unit.ID) + ":" + toJSONString(unit.Target))
+		sp = ",\n"
+	}
+	buff.WriteString("\n}\n")
+	if err := os.WriteFile(filename, buff.Bytes(), 0644); err != nil {
+		cfgdef.Error(err)
+	}
+}
+
+// 转换为JSON字符串, 不转义<>&, 便于翻译人员查看
+func toJSONString(s string) string {
+	var buff bytes.Buffer
+	enc := json.NewEncoder(&buff)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buff.String(), "\n")
+}
@@ -0,0 +1,133 @@
+package i18n
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gamewheels/cfgwheel/cfgdef"
+)
+
+// testUnits 包含需要转义的字符、未翻译和需要复核的译文
+var testUnits = []*Unit{
+	{ID: "ItemTable.1001.Name", Source: "长剑", Target: "Long Sword", Desc: "物品名称"},
+	{ID: "ItemTable.1001.Desc", Source: "攻击+10, \"锋利\"\n第二行", Target: "ATK+10, \"Sharp\"\nLine 2", Desc: "物品描述"},
+	{ID: "ItemTable.1002.Name", Source: "<盾> & 甲", Target: "<Shield> & Armor", Fuzzy: true},
+	{ID: "ItemTable.1002.Effects[0].Desc", Source: "路径\\名称\t制表", Target: ""},
+}
+
+// TestRoundTrip 写入后读取的翻译单元和写入前相同
+func TestRoundTrip(t *testing.T) {
+	for name, format := range formats {
+		t.Run(name, func(t *testing.T) {
+			var buff bytes.Buffer
+			if err := format.Write(&buff, "zh", "en", testUnits); err != nil {
+				t.Fatal(err)
+			}
+			units, err := format.Read(&buff)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(units) != len(testUnits) {
+				t.Fatalf("Read %d units, want %d", len(units), len(testUnits))
+			}
+			for i, unit := range units {
+				if !reflect.DeepEqual(unit, testUnits[i]) {
+					t.Errorf("unit %d = %+v, want %+v", i, *unit, *testUnits[i])
+				}
+			}
+		})
+	}
+}
+
+// TestExport 合并已有的译文, 源语言文本修改后需要复核, 数组元素的下标改变后按源语言文本找回译文
+func TestExport(t *testing.T) {
+	flags := cfgdef.ExportFlags
+	defer func() { cfgdef.ExportFlags = flags }()
+	cfgdef.ExportFlags.Langs = "zh,en"
+
+	for name, format := range formats {
+		t.Run(name, func(t *testing.T) {
+			cfgdef.ExportFlags.I18NFormat = name
+			dir := t.TempDir()
+			old := []*Unit{
+				{ID: "ItemTable.1001.Name", Source: "长剑", Target: "Long Sword"},
+				{ID: "ItemTable.1001.Desc", Source: "锋利", Target: "Sharp"},
+				{ID: "ItemTable.1001.Effects[0].Desc", Source: "燃烧", Target: "Burn"},
+				{ID: "ItemTable.1001.Effects[1].Desc", Source: "冰冻", Target: "Freeze", Fuzzy: true},
+			}
+			var buff bytes.Buffer
+			if err := format.Write(&buff, "zh", "en", old); err != nil {
+				t.Fatal(err)
+			}
+			filename := filepath.Join(dir, "en."+format.Ext())
+			if err := os.WriteFile(filename, buff.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			//修改了描述, 在效果数组的开头插入了一个元素
+			cfgMap := cfgdef.NewCfgMap()
+			for i, text := range []string{"长剑", "非常锋利", "眩晕", "燃烧", "冰冻"} {
+				id := []string{"Name", "Desc", "Effects[0].Desc", "Effects[1].Desc", "Effects[2].Desc"}[i]
+				cfgMap.AddText(&cfgdef.TextItem{ID: "ItemTable.1001." + id, Text: text,
+					Pos: &cfgdef.RowPos{File: "item.xlsx", Sheet: "ItemTable", Row: i}})
+			}
+			errorCount := cfgdef.ErrorCount
+			NewExporter(cfgMap).Export(dir)
+			if cfgdef.ErrorCount != errorCount {
+				t.Fatal("Export reported errors")
+			}
+
+			f, err := os.Open(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			units, err := format.Read(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []*Unit{
+				{ID: "ItemTable.1001.Name", Source: "长剑", Target: "Long Sword"},
+				{ID: "ItemTable.1001.Desc", Source: "非常锋利", Target: "Sharp", Fuzzy: true},
+				{ID: "ItemTable.1001.Effects[0].Desc", Source: "眩晕", Target: "Burn", Fuzzy: true},
+				{ID: "ItemTable.1001.Effects[1].Desc", Source: "燃烧", Target: "Burn"},
+				{ID: "ItemTable.1001.Effects[2].Desc", Source: "冰冻", Target: "Freeze", Fuzzy: true},
+			}
+			if !reflect.DeepEqual(units, want) {
+				var got []Unit
+				for _, unit := range units {
+					got = append(got, *unit)
+				}
+				t.Errorf("units = %+v", got)
+			}
+
+			//未翻译或者需要复核的文本在文本包中使用源语言文本
+			data, err := os.ReadFile(filepath.Join(dir, "text.en.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var bundle map[string]string
+			if err := json.Unmarshal(data, &bundle); err != nil {
+				t.Fatal(err)
+			}
+			wantBundle := map[string]string{
+				"ItemTable.1001.Name":            "Long Sword",
+				"ItemTable.1001.Desc":            "非常锋利",
+				"ItemTable.1001.Effects[0].Desc": "眩晕",
+				"ItemTable.1001.Effects[1].Desc": "Burn",
+				"ItemTable.1001.Effects[2].Desc": "冰冻",
+			}
+			if !reflect.DeepEqual(bundle, wantBundle) {
+				t.Errorf("bundle = %v, want %v", bundle, wantBundle)
+			}
+			if !strings.HasPrefix(string(data), "{\n") {
+				t.Errorf("bundle should put one text per line: %s", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package i18n
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// poFormat gettext PO翻译文件, msgctxt为文本ID
+type poFormat struct{}
+
+// Ext 文件扩展名
+func (poFormat) Ext() string {
+	return "po"
+}
+
+// Read 读取翻译文件
+func (poFormat) Read(r io.Reader) ([]*Unit, error) {
+	var units []*Unit
+	unit := &Unit{}
+	var last *string
+	flush := func() {
+		//跳过没有msgctxt的条目, 如文件头
+		if unit.ID != "" {
+			units = append(units, unit)
+		}
+		unit = &Unit{}
+		last = nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		//注释属于下一个条目, 兼容条目之间没有空行的情况
+		if strings.HasPrefix(line, "#") && last != nil {
+			flush()
+		}
+		switch {
+		case line == "":
+			flush()
+		case strings.HasPrefix(line, "#,"):
+			for _, flag := range strings.Split(line[2:], ",") {
+				if strings.TrimSpace(flag) == "fuzzy" {
+					unit.Fuzzy = true
+				}
+			}
+		case strings.HasPrefix(line, "#."):
+			unit.Desc = strings.TrimSpace(line[2:])
+		case strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "\""):
+			if last == nil {
+				return nil, fmt.Errorf("第%d行格式错误", n)
+			}
+			s, err := strconv.Unquote(line)
+			if err != nil {
+				return nil, fmt.Errorf("第%d行格式错误", n)
+			}
+			*last += s
+		default:
+			keyword, value := line, ""
+			if i := strings.Index(line, " "); i > 0 {
+				keyword, value = line[:i], strings.TrimSpace(line[i+1:])
+			}
+			switch keyword {
+			case "msgctxt":
+				if last != nil {
+					flush()
+				}
+				last = &unit.ID
+			case "msgid":
+				last = &unit.Source
+			case "msgstr":
+				last = &unit.Target
+			default:
+				return nil, fmt.Errorf("第%d行格式错误", n)
+			}
+			s, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("第%d行格式错误", n)
+			}
+			*last = s
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return units, nil
+}
+
+// Write 写入翻译文件
+func (poFormat) Write(w io.Writer, srcLang string, lang string, units []*Unit) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("msgid \"\"\nmsgstr \"\"\n")
+	bw.WriteString("\"Content-Type: text/plain; charset=UTF-8\\n\"\n")
+	bw.WriteString("\"Language: " + lang + "\\n\"\n")
+	bw.WriteString("\"X-Source-Language: " + srcLang + "\\n\"\n")
+	for _, unit := range units {
+		bw.WriteString("\n")
+		if unit.Desc != "" {
+			bw.WriteString("#. " + strings.ReplaceAll(unit.Desc, "\n", " ") + "\n")
+		}
+		if unit.Fuzzy {
+			bw.WriteString("#, fuzzy\n")
+		}
+		bw.WriteString("msgctxt " + poQuote(unit.ID) + "\n")
+		bw.WriteString("msgid " + poQuote(unit.Source) + "\n")
+		bw.WriteString("msgstr " + poQuote(unit.Target) + "\n")
+	}
+	return bw.Flush()
+}
+
+// 转换为PO字符串, 只转义PO格式支持的字符, 其它字符原样保留
+func poQuote(s string) string {
+	r := strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\r", "\\r", "\t", "\\t")
+	return "\"" + r.Replace(s) + "\""
+}
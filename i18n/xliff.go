@@ -0,0 +1,92 @@
+package i18n
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// xliffFormat XLIFF 1.2翻译文件
+type xliffFormat struct{}
+
+type xliffDoc struct {
+	XMLName xml.Name  `xml:"urn:oasis:names:tc:xliff:document:1.2 xliff"`
+	Version string    `xml:"version,attr"`
+	File    xliffFile `xml:"file"`
+}
+
+type xliffFile struct {
+	SourceLanguage string      `xml:"source-language,attr"`
+	TargetLanguage string      `xml:"target-language,attr"`
+	Datatype       string      `xml:"datatype,attr"`
+	Original       string      `xml:"original,attr"`
+	Units          []xliffUnit `xml:"body>trans-unit"`
+}
+
+type xliffUnit struct {
+	ID     string       `xml:"id,attr"`
+	Source string       `xml:"source"`
+	Target *xliffTarget `xml:"target,omitempty"`
+	Note   string       `xml:"note,omitempty"`
+}
+
+type xliffTarget struct {
+	State string `xml:"state,attr,omitempty"`
+	Text  string `xml:",chardata"`
+}
+
+// 需要复核的译文的状态
+const xliffStateFuzzy = "needs-review-translation"
+
+// Ext 文件扩展名
+func (xliffFormat) Ext() string {
+	return "xlf"
+}
+
+// Read 读取翻译文件
+func (xliffFormat) Read(r io.Reader) ([]*Unit, error) {
+	var doc xliffDoc
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	units := make([]*Unit, 0, len(doc.File.Units))
+	for _, u := range doc.File.Units {
+		unit := &Unit{ID: u.ID, Source: u.Source, Desc: u.Note}
+		if u.Target != nil {
+			unit.Target = u.Target.Text
+			unit.Fuzzy = u.Target.State == xliffStateFuzzy
+		}
+		units = append(units, unit)
+	}
+	return units, nil
+}
+
+// Write 写入翻译文件
+func (xliffFormat) Write(w io.Writer, srcLang string, lang string, units []*Unit) error {
+	doc := xliffDoc{
+		Version: "1.2",
+		File: xliffFile{
+			SourceLanguage: srcLang,
+			TargetLanguage: lang,
+			Datatype:       "plaintext",
+			Original:       "gameconfig",
+		},
+	}
+	for _, unit := range units {
+		u := xliffUnit{ID: unit.ID, Source: unit.Source, Note: unit.Desc}
+		if unit.Target != "" {
+			u.Target = &xliffTarget{Text: unit.Target, State: "translated"}
+			if unit.Fuzzy {
+				u.Target.State = xliffStateFuzzy
+			}
+		}
+		doc.File.Units = append(doc.File.Units, u)
+	}
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
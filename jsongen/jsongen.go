@@ -3,24 +3,57 @@ package jsongen
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gamewheels/cfgwheel/cfgdef"
+	"github.com/gamewheels/cfgwheel/cfgexpr"
 )
 
 // JSONGen json生成器
 type JSONGen struct {
 	cfgMap *cfgdef.CfgMap
+	loc    *time.Location // datetime字段的时区
+
+	rowPos   *cfgdef.RowPos // 当前处理的数据行
+	rowPath  string         // 当前数据行的路径, 如: ItemTable.1001
+	textPath string         // 当前字段的本地化文本ID, 如: ItemTable.1001.Effects[0].Desc, 数组元素使用下标, 插入或者删除元素后会改变
+
+	patterns map[string]*regexp.Regexp // 字符串格式约束
+	assets   []string                  // 当前单元格中不存在的资源
+	keySets  map[string]*keySet        // 外键关联的主键或者字段值
+
+	rows   map[string][]string       // 生成的数据行, 用于检查校验规则
+	tables map[string]*cfgexpr.Table // 解析后的数据行
 }
 
-var currentLine = 0
+// currentPos 当前处理的数据行, 用于输出错误位置
+var currentPos = ""
 
 // NewJSONGen 构建json生成器
 func NewJSONGen(cfgMap *cfgdef.CfgMap) *JSONGen {
+	loc, err := time.LoadLocation(cfgdef.ExportFlags.TimeZone)
+	if err != nil {
+		cfgdef.Error("时区无效", cfgdef.ExportFlags.TimeZone)
+		loc = time.UTC
+	}
 	return &JSONGen{
-		cfgMap: cfgMap,
+		cfgMap:   cfgMap,
+		loc:      loc,
+		patterns: make(map[string]*regexp.Regexp),
+		keySets:  make(map[string]*keySet),
+		rows:     make(map[string][]string),
+		tables:   make(map[string]*cfgexpr.Table),
 	}
 }
 
@@ -35,7 +68,8 @@ func genStructName(name string) string {
 
 // GenFileName 生成文件名
 func (gen *JSONGen) GenFileName(name string) string {
-	if strings.HasSuffix(name, "Enum") || strings.HasSuffix(name, "Struct") {
+	if strings.HasSuffix(name, "Enum") || strings.HasSuffix(name, "Flags") || strings.HasSuffix(name, "Union") ||
+		strings.HasSuffix(name, "Struct") {
 		return ""
 	}
 	return name + ".json"
@@ -46,11 +80,16 @@ func (gen *JSONGen) GenEnum(name string) string {
 	return ""
 }
 
+// GenUnion 生成联合体
+func (gen *JSONGen) GenUnion(name string) string {
+	return ""
+}
+
 // GenTable 生成表
 func (gen *JSONGen) GenTable(name string) string {
 	tableDef := gen.cfgMap.TableMap[name]
 	if tableDef == nil || len(tableDef.Fields) == 0 {
-		fmt.Println("error: ", name, "定义无效")
+		cfgdef.Error(name, "定义无效")
 		return ""
 	}
 
@@ -58,19 +97,30 @@ func (gen *JSONGen) GenTable(name string) string {
 
 	if isSettings {
 		if len(tableDef.Data) < 1 {
-			fmt.Println("error: ", name, "缺少配置数据")
+			cfgdef.Error(name, "缺少配置数据")
 			return ""
 		}
-		return gen.genStructValue(tableDef.Data[0], tableDef)
+		currentPos = tableDef.DataPos[0].String()
+		gen.rowPos = tableDef.DataPos[0]
+		gen.rowPath = name
+		gen.textPath = name
+		s := gen.genStructValue(tableDef.Data[0], tableDef)
+		gen.rows[name] = []string{s}
+		return s
 	}
 
 	var buff bytes.Buffer
 	buff.WriteString("[")
 	sp := ""
 	for i := 0; i < len(tableDef.Data); i++ {
-		currentLine = i + 6
+		currentPos = tableDef.DataPos[i].String()
+		gen.rowPos = tableDef.DataPos[i]
+		gen.rowPath = name + "." + cfgdef.Trim(tableDef.Data[i][tableDef.Key])
+		gen.textPath = gen.rowPath
+		s := gen.genStructValue(tableDef.Data[i], tableDef)
+		gen.rows[name] = append(gen.rows[name], s)
 		buff.WriteString(sp)
-		buff.WriteString(gen.genStructValue(tableDef.Data[i], tableDef))
+		buff.WriteString(s)
 		sp = ",\n"
 	}
 	buff.WriteString("]")
@@ -80,6 +130,9 @@ func (gen *JSONGen) GenTable(name string) string {
 // 生成枚举值
 func (gen *JSONGen) genEnumValue(s string, field *cfgdef.FieldDef) string {
 	enumDef, ok := gen.cfgMap.EnumMap[field.Type]
+	if ok && enumDef.IsFlags {
+		return gen.genFlagsValue(s, enumDef)
+	}
 	if ok {
 		s = cfgdef.Trim(s)
 		if s == "" {
@@ -90,10 +143,52 @@ func (gen *JSONGen) genEnumValue(s string, field *cfgdef.FieldDef) string {
 			return value.Value
 		}
 	}
-	fmt.Printf("error: line[%d] 枚举%s.%s未定义\n", currentLine, field.Type, s)
+	cfgdef.Errorf("%s 枚举%s.%s未定义\n", currentPos, field.Type, s)
 	return toIntValue(s)
 }
 
+// 生成标记枚举值, 如: Fire|Ice
+func (gen *JSONGen) genFlagsValue(s string, enumDef *cfgdef.EnumDef) string {
+	var value uint64
+	for _, name := range strings.Split(s, "|") {
+		name = cfgdef.Trim(name)
+		if name == "" {
+			continue
+		}
+		item, ok := enumDef.ItemsMap[name]
+		if !ok {
+			cfgdef.Errorf("%s 枚举%s.%s未定义\n", currentPos, enumDef.Name, name)
+			continue
+		}
+		v, err := strconv.ParseUint(item.Value, 0, 64)
+		if err != nil {
+			cfgdef.Errorf("%s 枚举%s.%s的值%s无效\n", currentPos, enumDef.Name, name, item.Value)
+			continue
+		}
+		value |= v
+	}
+	return strconv.FormatUint(value, 10)
+}
+
+// 生成填写为数值的标记枚举值, 只能包含已定义的标志位
+func (gen *JSONGen) genFlagsNumber(s string, enumDef *cfgdef.EnumDef) string {
+	value, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		cfgdef.Errorf("%s %s 转换为%s 失败\n", currentPos, s, enumDef.Name)
+		return "0"
+	}
+	var mask uint64
+	for _, item := range enumDef.Items {
+		if v, err := strconv.ParseUint(item.Value, 0, 64); err == nil {
+			mask |= v
+		}
+	}
+	if value&^mask != 0 {
+		cfgdef.Errorf("%s 枚举%s的标志位%d未定义\n", currentPos, enumDef.Name, value&^mask)
+	}
+	return strconv.FormatUint(value, 10)
+}
+
 // 转换为true/false
 func toBoolValue(s string) string {
 	s = strings.ToLower(cfgdef.Trim(s))
@@ -121,10 +216,89 @@ func toNumberValue(s string) string {
 	if err == nil {
 		return s
 	}
-	fmt.Printf("error: line[%d] %s 转换为数字失败\n", currentLine, s)
+	cfgdef.Errorf("%s %s 转换为数字失败\n", currentPos, s)
 	return s
 }
 
+// datetime字段支持的时间格式
+var dateTimeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"2006/01/02",
+}
+
+//转换为日期时间字段值(Unix秒), 未指定时区的时间按照导出参数中的时区解析
+func (gen *JSONGen) toDateTimeValue(s string) string {
+	s = cfgdef.Trim(s)
+	if s == "" {
+		return "0"
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, gen.loc); err == nil {
+			return strconv.FormatInt(t.Unix(), 10)
+		}
+	}
+	cfgdef.Errorf("%s %s 转换为日期时间失败\n", currentPos, s)
+	return "0"
+}
+
+//转换为时长字段值(毫秒), 如: 1h30m, 500ms, 2d12h
+func toDurationValue(s string) string {
+	s = cfgdef.Trim(s)
+	if s == "" || s == "0" {
+		return "0"
+	}
+	var days int64
+	if n := strings.Index(s, "d"); n > 0 {
+		if v, err := strconv.ParseInt(s[:n], 10, 64); err == nil {
+			days = v
+			s = s[n+1:]
+		}
+	}
+	var d time.Duration
+	if s != "" {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			cfgdef.Errorf("%s %s 转换为时长失败, 需要填写单位, 如: 1h30m, 500ms\n", currentPos, s)
+			return "0"
+		}
+	}
+	if days < 0 {
+		d = -d
+	}
+	return strconv.FormatInt(days*int64(24*time.Hour/time.Millisecond)+d.Milliseconds(), 10)
+}
+
+//转换为定点数字段值(原始值), 按照单元格的文本精确转换并四舍五入, 如: 0.1, 1.5e-2, 1/3
+func toFixedValue(s string) string {
+	s = cfgdef.Trim(s)
+	if s == "" {
+		return "0"
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		cfgdef.Errorf("%s %s 转换为定点数失败\n", currentPos, s)
+		return "0"
+	}
+	num := new(big.Int).Lsh(r.Num(), cfgdef.ExportFlags.FixedBits)
+	q, m := new(big.Int).QuoRem(num, r.Denom(), new(big.Int))
+	if m.Lsh(m.Abs(m), 1).Cmp(r.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(num.Sign())))
+	}
+	if !q.IsInt64() {
+		cfgdef.Errorf("%s %s 超出定点数的取值范围\n", currentPos, s)
+		return "0"
+	}
+	return q.String()
+}
+
 //转换为整形字段值
 func toIntValue(s string) string {
 	var value int64
@@ -133,7 +307,7 @@ func toIntValue(s string) string {
 	if err == nil {
 		return s
 	}
-	fmt.Printf("error: line[%d] %s 转换为整数失败\n", currentLine, s)
+	cfgdef.Errorf("%s %s 转换为整数失败\n", currentPos, s)
 	return s
 }
 
@@ -148,7 +322,7 @@ func toUIntValue(s string) string {
 	if err == nil {
 		return s
 	}
-	fmt.Printf("error: line[%d] %s 转换为正整数失败\n", currentLine, s)
+	cfgdef.Errorf("%s %s 转换为正整数失败\n", currentPos, s)
 	return s
 }
 
@@ -207,7 +381,7 @@ func (gen *JSONGen) genArrayValue(s string, field *cfgdef.FieldDef) string {
 	}
 	var temp []cfgdef.AnyField
 	if json.Unmarshal([]byte(s), &temp) != nil {
-		fmt.Printf("error: line[%d] %s 转换为数组失败\n", currentLine, s)
+		cfgdef.Errorf("%s %s 转换为数组失败\n", currentPos, s)
 		return "null"
 	}
 
@@ -226,14 +400,14 @@ func (gen *JSONGen) genArrayValue(s string, field *cfgdef.FieldDef) string {
 func (gen *JSONGen) genStructFromString(s string, typeName string) string {
 	structDef, ok := gen.cfgMap.TableMap[typeName]
 	if !ok {
-		fmt.Println("error: ", typeName, " 未定义")
+		cfgdef.Error(typeName, "未定义")
 		return "null"
 	}
 	s = cfgdef.Trim(s)
 	if cfgdef.IsJSONArray(s) {
 		var temp []cfgdef.AnyField
 		if json.Unmarshal([]byte(s), &temp) != nil {
-			fmt.Printf("error: line[%d] %s 转换为 %s 失败\n", currentLine, s, typeName)
+			cfgdef.Errorf("%s %s 转换为 %s 失败\n", currentPos, s, typeName)
 			return "null"
 		}
 		var buff bytes.Buffer
@@ -249,7 +423,7 @@ func (gen *JSONGen) genStructFromString(s string, typeName string) string {
 	} else if cfgdef.IsJSONObject(s) {
 		var temp map[string]cfgdef.AnyField
 		if json.Unmarshal([]byte(s), &temp) != nil {
-			fmt.Printf("error: line[%d] %s 转换为 %s 失败\n", currentLine, s, typeName)
+			cfgdef.Errorf("%s %s 转换为 %s 失败\n", currentPos, s, typeName)
 			return "null"
 		}
 		var buff bytes.Buffer
@@ -273,33 +447,36 @@ func (gen *JSONGen) genFieldValue2(jo interface{}, field *cfgdef.FieldDef) strin
 		case nil:
 			return "null"
 		case []interface{}:
-			f := &cfgdef.FieldDef{
-				Name:     field.Name,
-				Type:     field.Type,
-				IsArray:  false,
-				IsStruct: field.IsStruct,
-				UseFor:   field.UseFor,
-				FTable:   field.FTable,
-			}
+			//元素使用字段的类型和约束, 数组的长度范围不作用于元素
+			elem := *field
+			elem.IsArray = false
+			elem.Len = nil
+			f := &elem
 			array := jo.([]interface{})
 			var buff bytes.Buffer
 			sp := ""
+			path := gen.textPath
 			buff.WriteString("[")
-			for _, a := range array {
+			for i, a := range array {
+				gen.textPath = path + "[" + strconv.Itoa(i) + "]"
 				buff.WriteString(sp + gen.genFieldValue2(a, f))
 				sp = ","
 			}
 			buff.WriteString("]")
+			gen.textPath = path
 			return buff.String()
 		default:
-			fmt.Printf("error: line[%d] %s 转换为[]%s 失败\n", currentLine, jo, field.Type)
+			cfgdef.Errorf("%s %s 转换为[]%s 失败\n", currentPos, jo, field.Type)
 			return "null"
 		}
 	}
+	if field.IsUnion {
+		return gen.genUnionValue(jo, field)
+	}
 	if field.IsStruct {
 		def, ok := gen.cfgMap.TableMap[field.Type]
 		if !ok {
-			fmt.Println("error: ", field.Type, " 未定义")
+			cfgdef.Error(field.Type, "未定义")
 			return "null"
 		}
 		switch jo.(type) {
@@ -309,35 +486,76 @@ func (gen *JSONGen) genFieldValue2(jo interface{}, field *cfgdef.FieldDef) strin
 			array := jo.([]interface{})
 			var buff bytes.Buffer
 			sp := ""
+			path := gen.textPath
 			buff.WriteString("{")
 			for n, v := range array {
 				if n < len(def.Fields) {
 					f := def.Fields[n]
-					buff.WriteString(sp + `"` + f.Name + `":` + gen.genFieldValue2(v, f))
+					gen.textPath = path + "." + f.Name
+					value := gen.genFieldValue2(v, f)
+					gen.checkField(value, f)
+					buff.WriteString(sp + `"` + f.Name + `":` + value)
 					sp = ","
 				}
 			}
 			buff.WriteString("}")
+			gen.textPath = path
 			return buff.String()
 		case map[string]interface{}:
 			data := jo.(map[string]interface{})
 			var buff bytes.Buffer
 			sp := ""
+			path := gen.textPath
 			buff.WriteString("{")
 			for k, v := range data {
 				f := def.FieldsMap[k]
 				if def.FieldsMap[k] != nil {
-					buff.WriteString(sp + `"` + f.Name + `":` + gen.genFieldValue2(v, f))
+					gen.textPath = path + "." + f.Name
+					value := gen.genFieldValue2(v, f)
+					gen.checkField(value, f)
+					buff.WriteString(sp + `"` + f.Name + `":` + value)
 					sp = ","
 				}
 			}
 			buff.WriteString("}")
+			gen.textPath = path
 			return buff.String()
 		default:
-			fmt.Printf("error: line[%d] %s 转换为%s 失败\n", currentLine, jo, field.Type)
+			cfgdef.Errorf("%s %s 转换为%s 失败\n", currentPos, jo, field.Type)
 			return "null"
 		}
 	}
+	if field.IsEnum {
+		return gen.genEnumFromJSON(jo, field)
+	}
+	if isValueType(field.Type) {
+		return gen.genValueTypeValue(jo, field)
+	}
+	switch field.Type {
+	case "text":
+		return gen.genTextValue(jo, field)
+	case "fixed":
+		switch v := jo.(type) {
+		case nil:
+			return "0"
+		case string:
+			return toFixedValue(v)
+		case json.Number:
+			return toFixedValue(v.String())
+		}
+		cfgdef.Errorf("%s %v 转换为%s 失败\n", currentPos, jo, field.Type)
+		return "0"
+	case "datetime", "duration":
+		str, ok := jo.(string)
+		if !ok {
+			cfgdef.Errorf("%s %v 转换为%s 失败\n", currentPos, jo, field.Type)
+			return "0"
+		}
+		if field.Type == "datetime" {
+			return gen.toDateTimeValue(str)
+		}
+		return toDurationValue(str)
+	}
 	bytes, _ := json.Marshal(jo)
 	s := string(bytes)
 	switch field.Type {
@@ -353,6 +571,256 @@ func (gen *JSONGen) genFieldValue2(jo interface{}, field *cfgdef.FieldDef) strin
 	return s
 }
 
+//生成数组元素、结构体字段中的枚举值, 可以填写枚举项名称或者已定义的枚举值, 标记枚举可以填写 Fire|Ice
+func (gen *JSONGen) genEnumFromJSON(jo interface{}, field *cfgdef.FieldDef) string {
+	switch v := jo.(type) {
+	case nil:
+		return gen.genEnumValue("", field)
+	case string:
+		return gen.genEnumValue(v, field)
+	case json.Number:
+		if enumDef, ok := gen.cfgMap.EnumMap[field.Type]; ok {
+			if enumDef.IsFlags {
+				return gen.genFlagsNumber(v.String(), enumDef)
+			}
+			value := gen.NormalizeKey(v.String(), field)
+			for _, item := range enumDef.Items {
+				if gen.NormalizeKey(item.Value, field) == value {
+					return value
+				}
+			}
+		}
+		cfgdef.Errorf("%s 枚举%s.%s未定义\n", currentPos, field.Type, v)
+		return toIntValue(v.String())
+	}
+	cfgdef.Errorf("%s %v 转换为%s 失败\n", currentPos, jo, field.Type)
+	return "0"
+}
+
+//生成联合体, 单元格可以填写 {"Type":"变体名", 数据字段...} 或者 ["变体名", 数据字段...]
+func (gen *JSONGen) genUnionValue(jo interface{}, field *cfgdef.FieldDef) string {
+	unionDef, ok := gen.cfgMap.UnionMap[field.Type]
+	if !ok {
+		cfgdef.Error(field.Type, "未定义")
+		return "null"
+	}
+	switch jo.(type) {
+	case nil:
+		return "null"
+	case []interface{}, map[string]interface{}:
+	default:
+		cfgdef.Errorf("%s %v 转换为%s 失败\n", currentPos, jo, field.Type)
+		return "null"
+	}
+
+	typeName, data := unionData(jo)
+	name, _ := typeName.(string)
+	item, ok := unionDef.ItemsMap[cfgdef.Trim(name)]
+	if !ok {
+		cfgdef.Errorf("%s %s: 联合体%s的类型%v未定义\n", currentPos, field.Name, field.Type, typeName)
+		return "null"
+	}
+	value := gen.genEnumValue(item.Name, &cfgdef.FieldDef{Name: field.Name, Type: unionDef.Enum, IsEnum: true})
+	if item.Struct == "" {
+		return `{"Type":` + value + `,"Data":null}`
+	}
+
+	//校验数据是否符合选中的结构体
+	structDef, ok := gen.cfgMap.TableMap[item.Struct]
+	if !ok {
+		cfgdef.Error(item.Struct, "未定义")
+		return "null"
+	}
+	switch d := data.(type) {
+	case []interface{}:
+		if len(d) > len(structDef.Fields) {
+			cfgdef.Errorf("%s %s: %s.%s 的数据字段过多\n", currentPos, field.Name, field.Type, item.Name)
+		}
+	case map[string]interface{}:
+		for k := range d {
+			if _, ok := structDef.FieldsMap[k]; !ok {
+				cfgdef.Errorf("%s %s: %s.%s 没有字段%s\n", currentPos, field.Name, field.Type, item.Name, k)
+			}
+		}
+	}
+	payload := gen.genFieldValue2(data, &cfgdef.FieldDef{Name: field.Name, Type: item.Struct, IsStruct: true})
+	return `{"Type":` + value + `,"Data":` + payload + `}`
+}
+
+//拆分联合体单元格的变体名和数据, 如: ["变体名", 数据字段...] 或者 {"Type":"变体名", 数据字段...}
+func unionData(jo interface{}) (interface{}, interface{}) {
+	switch v := jo.(type) {
+	case []interface{}:
+		if len(v) > 0 {
+			return v[0], v[1:]
+		}
+	case map[string]interface{}:
+		if d, ok := v["Data"]; ok {
+			return v["Type"], d
+		}
+		temp := make(map[string]interface{})
+		for k, a := range v {
+			if k != "Type" {
+				temp[k] = a
+			}
+		}
+		return v["Type"], temp
+	}
+	return nil, nil
+}
+
+//生成本地化文本, 源语言文本登记到文本表中, 数据中填写文本ID
+func (gen *JSONGen) genTextValue(jo interface{}, field *cfgdef.FieldDef) string {
+	if jo == nil {
+		return `""`
+	}
+	s, ok := jo.(string)
+	if !ok {
+		cfgdef.Errorf("%s %v 转换为%s 失败\n", currentPos, jo, field.Type)
+		return `""`
+	}
+	if cfgdef.Trim(s) == "" {
+		return `""`
+	}
+	if field.Len != nil {
+		gen.checkLen(toStringValue(s), &cfgdef.FieldDef{Name: field.Name, Type: "string", Len: field.Len})
+	}
+	gen.checkString(s, field)
+	item := &cfgdef.TextItem{ID: gen.textPath, Text: s, Desc: field.Desc, Pos: gen.rowPos}
+	if !gen.cfgMap.AddText(item) {
+		cfgdef.Errorf("%s 本地化文本ID重复: %s\n", currentPos, item.ID)
+	}
+	return toStringValue(item.ID)
+}
+
+//是否是向量、颜色、取值范围等内置值类型
+func isValueType(typeName string) bool {
+	switch typeName {
+	case "vec2", "vec3", "color":
+		return true
+	}
+	return cfgdef.GetRangeType(typeName) != ""
+}
+
+//生成向量、颜色、取值范围等内置值类型, 如:
+//  vec2/vec3: 1,2,3 或 [1,2,3] 或 {"x":1,"y":2,"z":3}
+//  color: #RRGGBB 或 #RRGGBBAA 或 [r,g,b,a] (0~1)
+//  range<T>: 1~5 或 1,5 或 [1,5] 或 {"min":1,"max":5}
+func (gen *JSONGen) genValueTypeValue(jo interface{}, field *cfgdef.FieldDef) string {
+	var keys []string
+	elemType := "float32"
+	switch field.Type {
+	case "vec2":
+		keys = []string{"x", "y"}
+	case "vec3":
+		keys = []string{"x", "y", "z"}
+	case "color":
+		keys = []string{"r", "g", "b", "a"}
+	default:
+		keys = []string{"min", "max"}
+		elemType = cfgdef.GetRangeType(field.Type)
+	}
+
+	var values []interface{}
+	switch v := jo.(type) {
+	case nil:
+	case string:
+		s := cfgdef.Trim(v)
+		if field.Type == "color" && strings.HasPrefix(s, "#") {
+			return gen.genColorValue(s)
+		}
+		s = strings.TrimSuffix(strings.TrimPrefix(s, "("), ")")
+		sep := ","
+		if keys[0] == "min" && strings.Contains(s, "~") {
+			sep = "~"
+		}
+		if s != "" {
+			for _, e := range strings.Split(s, sep) {
+				var value interface{}
+				if json.Unmarshal([]byte(cfgdef.Trim(e)), &value) != nil {
+					cfgdef.Errorf("%s %s: %s 转换为%s 失败\n", currentPos, field.Name, v, field.Type)
+					return "null"
+				}
+				values = append(values, value)
+			}
+		}
+	case []interface{}:
+		values = v
+	case map[string]interface{}:
+		for _, k := range keys {
+			value, ok := v[k]
+			if !ok {
+				value = v[strings.ToUpper(k[:1])+k[1:]]
+			}
+			values = append(values, value)
+		}
+	default:
+		cfgdef.Errorf("%s %s: %v 转换为%s 失败\n", currentPos, field.Name, jo, field.Type)
+		return "null"
+	}
+
+	//颜色可以不填alpha, 默认为1
+	if field.Type == "color" && len(values) == 3 {
+		values = append(values, 1.0)
+	}
+	if len(values) != 0 && len(values) != len(keys) {
+		cfgdef.Errorf("%s %s: %v 转换为%s 失败, 需要%d个分量\n", currentPos, field.Name, jo, field.Type, len(keys))
+		return "null"
+	}
+
+	var buff bytes.Buffer
+	buff.WriteString("{")
+	nums := make([]float64, len(keys))
+	for i, k := range keys {
+		var value interface{} = 0
+		if i < len(values) && values[i] != nil {
+			value = values[i]
+		}
+		s := gen.genFieldValue2(value, &cfgdef.FieldDef{Name: field.Name, Type: elemType})
+		json.Unmarshal([]byte(s), &nums[i])
+		if i > 0 {
+			buff.WriteString(",")
+		}
+		buff.WriteString(`"` + k + `":` + s)
+	}
+	buff.WriteString("}")
+
+	if field.Type == "color" {
+		for i, n := range nums {
+			if n < 0 || n > 1 {
+				cfgdef.Errorf("%s %s: 颜色分量%s的取值范围为0~1: %v\n", currentPos, field.Name, keys[i], n)
+			}
+		}
+	} else if keys[0] == "min" && nums[0] > nums[1] {
+		cfgdef.Errorf("%s %s: 取值范围的最小值大于最大值: %v\n", currentPos, field.Name, jo)
+	}
+	return buff.String()
+}
+
+//生成颜色, #RRGGBB 或 #RRGGBBAA
+func (gen *JSONGen) genColorValue(s string) string {
+	hex := s[1:]
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || err != nil {
+		cfgdef.Errorf("%s %s 转换为颜色失败, 格式为#RRGGBB或者#RRGGBBAA\n", currentPos, s)
+		return "null"
+	}
+	var buff bytes.Buffer
+	buff.WriteString("{")
+	for i, k := range []string{"r", "g", "b", "a"} {
+		c := float64((v>>uint(24-i*8))&0xff) / 255
+		if i > 0 {
+			buff.WriteString(",")
+		}
+		buff.WriteString(`"` + k + `":` + strconv.FormatFloat(c, 'f', -1, 32))
+	}
+	buff.WriteString("}")
+	return buff.String()
+}
+
 func (gen *JSONGen) genObjectString(jo interface{}, structDef *cfgdef.TableDef) string {
 	switch jo.(type) {
 	case []interface{}:
@@ -377,80 +845,347 @@ func (gen *JSONGen) genObjectString(jo interface{}, structDef *cfgdef.TableDef)
 func (gen *JSONGen) genStructValue(cols []string, structDef *cfgdef.TableDef) string {
 	var buff bytes.Buffer
 	sp := ""
+	path := gen.textPath
 	buff.WriteString("{")
 	for j := 0; j < len(cols); j++ {
 		field := structDef.Fields[j]
-		if field.Name != "" && field.Type != "" &&
-			(field.IsKey || field.UseFor == "A" || field.UseFor == cfgdef.ExportFlags.UseFor) {
-			var jo interface{}
-			var bytes []byte
-			if field.IsArray {
-				s := cfgdef.Trim(cols[j])
-				if s == "" {
-					s = "[]"
-				}
-				bytes = []byte(s)
-			} else if field.IsStruct {
-				s := cfgdef.Trim(cols[j])
-				if s == "" {
-					s = "null"
-				}
-				bytes = []byte(s)
-			} else if field.IsEnum {
-				s := gen.genEnumValue(cols[j], field)
-				bytes = []byte(s)
-			} else if field.Type == "bool" {
-				s := cfgdef.Trim(strings.ToLower(cols[j]))
-				if s == "" {
-					s = "false"
-				}
-				bytes = []byte(s)
-			} else if field.Type == "string" {
-				bytes, _ = json.Marshal(cols[j])
-			} else {
-				s := cfgdef.Trim(cols[j])
-				if s == "" {
-					s = "0"
-				}
-				bytes = []byte(s)
-			}
-			err := json.Unmarshal(bytes, &jo)
-			var value string
-			if err != nil {
-				fmt.Printf("error: line[%d] %s: %s 转换为%s 失败\n", currentLine, field.Name, cols[j], cfgdef.GetFullTypeName(field.Type, field.IsArray))
-			} else {
-				value = gen.genFieldValue2(jo, field)
-				if field.IsArray {
-					gen.checkArray(value, field)
-				} else {
-					gen.checkValue(value, field)
-				}
-				buff.WriteString(sp + "\"" + field.Name + "\":" + value)
-				sp = ","
+		if field.Name == "" || field.Type == "" {
+			continue
+		}
+		gen.textPath = path + "." + field.Name
+		jo, err := decodeCell(cols[j], field)
+		if !field.IsKey && field.UseFor != "A" && field.UseFor != cfgdef.ExportFlags.UseFor {
+			//没有导出的字段也收集外键引用, 引用关系和导出的用途无关
+			if err == nil {
+				gen.collectRefs(jo, field)
 			}
+			continue
 		}
+		if err != nil {
+			cfgdef.Errorf("%s %s: %s 转换为%s 失败\n", currentPos, field.Name, cols[j], cfgdef.GetFullTypeName(field.Type, field.IsArray))
+			continue
+		}
+		value := gen.genFieldValue2(jo, field)
+		gen.checkField(value, field)
+		if len(gen.assets) > 0 {
+			cfgdef.Error(gen.rowPos.Cell(j), "资源不存在", strings.Join(gen.assets, ", "))
+			gen.assets = nil
+		}
+		buff.WriteString(sp + "\"" + field.Name + "\":" + value)
+		sp = ","
 	}
+	gen.textPath = path
 	buff.WriteString("}")
 	return buff.String()
 }
 
-//外键关联检查
+//解析单元格, 数组、结构体等填写JSON, 其他类型按照文本处理
+func decodeCell(cell string, field *cfgdef.FieldDef) (interface{}, error) {
+	var bytes []byte
+	if field.IsArray {
+		s := cfgdef.Trim(cell)
+		if s == "" {
+			s = "[]"
+		}
+		bytes = []byte(s)
+	} else if field.IsStruct || field.IsUnion {
+		s := cfgdef.Trim(cell)
+		if s == "" {
+			s = "null"
+		}
+		bytes = []byte(s)
+	} else if field.IsEnum {
+		bytes, _ = json.Marshal(cell)
+	} else if field.Type == "bool" {
+		s := cfgdef.Trim(strings.ToLower(cell))
+		if s == "" {
+			s = "false"
+		}
+		bytes = []byte(s)
+	} else if field.Type == "string" || field.Type == "text" {
+		bytes, _ = json.Marshal(cell)
+	} else if field.Type == "datetime" || field.Type == "duration" || field.Type == "fixed" {
+		bytes, _ = json.Marshal(cfgdef.Trim(cell))
+	} else if isValueType(field.Type) {
+		s := cfgdef.Trim(cell)
+		if cfgdef.IsJSONArray(s) || cfgdef.IsJSONObject(s) {
+			bytes = []byte(s)
+		} else {
+			bytes, _ = json.Marshal(s)
+		}
+	} else {
+		s := cfgdef.Trim(cell)
+		if s == "" {
+			s = "0"
+		}
+		bytes = []byte(s)
+	}
+	//使用json.Number保留数字的原始文本, 定点数需要按照文本精确转换
+	var jo interface{}
+	d := json.NewDecoder(strings.NewReader(string(bytes)))
+	d.UseNumber()
+	if err := d.Decode(&jo); err != nil {
+		return nil, err
+	}
+	if d.More() {
+		return nil, errors.New("多余的内容")
+	}
+	return jo, nil
+}
+
+//收集字段值中的外键引用, 包括数组元素、结构体字段和联合体数据, 不检查数据
+func (gen *JSONGen) collectRefs(jo interface{}, field *cfgdef.FieldDef) {
+	path := gen.textPath
+	defer func() {
+		gen.textPath = path
+	}()
+	if field.IsArray {
+		array, _ := jo.([]interface{})
+		elem := *field
+		elem.IsArray = false
+		for i, a := range array {
+			gen.textPath = path + "[" + strconv.Itoa(i) + "]"
+			gen.collectRefs(a, &elem)
+		}
+		return
+	}
+
+	structName, data := "", jo
+	if field.IsUnion {
+		unionDef, ok := gen.cfgMap.UnionMap[field.Type]
+		if !ok {
+			return
+		}
+		typeName, d := unionData(jo)
+		name, _ := typeName.(string)
+		if item, ok := unionDef.ItemsMap[cfgdef.Trim(name)]; ok {
+			structName, data = item.Struct, d
+		}
+	} else if field.IsStruct {
+		structName = field.Type
+	}
+	if field.IsUnion || field.IsStruct {
+		def, ok := gen.cfgMap.TableMap[structName]
+		if !ok {
+			return
+		}
+		switch d := data.(type) {
+		case []interface{}:
+			for n, v := range d {
+				if f, ok := def.Fields[n]; ok {
+					gen.textPath = path + "." + f.Name
+					gen.collectRefs(v, f)
+				}
+			}
+		case map[string]interface{}:
+			for k, v := range d {
+				if f, ok := def.FieldsMap[k]; ok {
+					gen.textPath = path + "." + f.Name
+					gen.collectRefs(v, f)
+				}
+			}
+		}
+		return
+	}
+
+	if field.FTable == "" {
+		return
+	}
+	set := gen.getKeySet(field.FTable)
+	if set == nil || set.table == "" {
+		return
+	}
+	text := ""
+	switch v := jo.(type) {
+	case string:
+		text = v
+	case json.Number:
+		text = v.String()
+	default:
+		return
+	}
+	key := gen.NormalizeKey(text, set.field)
+	if key == "" || key == "0" {
+		return
+	}
+	if raw, ok := set.keys[key]; ok {
+		gen.addRef(set, raw)
+	}
+}
+
+// keySet 外键关联的值, 按照关联字段的类型规范化, 如: 1.0 和 1 是相同的整数主键
+type keySet struct {
+	table string            // 关联表格的主键时为表格名称, 用于记录引用
+	field *cfgdef.FieldDef  // 关联字段
+	keys  map[string]string // 规范化的值 -> 单元格中填写的值
+}
+
+//外键关联检查, F[Name]关联Name或者NameTable表的主键, F[Sheet.Field]关联表格或者设置中某个字段的值,
+//关联枚举时值需要是枚举项的值
 func (gen *JSONGen) checkFTable(s string, field *cfgdef.FieldDef) {
-	if ft, ok := gen.cfgMap.TableMap[field.FTable+"Table"]; ok {
-		if s != "0" {
-			if _, ok := ft.DataMap[s]; !ok {
-				fmt.Println("error: 没找到", field.FTable, s)
+	set := gen.getKeySet(field.FTable)
+	if set == nil {
+		return
+	}
+	var v interface{}
+	d := json.NewDecoder(strings.NewReader(s))
+	d.UseNumber()
+	if d.Decode(&v) != nil {
+		return
+	}
+	text := ""
+	switch x := v.(type) {
+	case string:
+		text = x
+	case json.Number:
+		text = x.String()
+	default:
+		return
+	}
+	//0和空字符串表示没有关联
+	key := gen.NormalizeKey(text, set.field)
+	if key == "" || key == "0" {
+		return
+	}
+	raw, ok := set.keys[key]
+	if !ok {
+		cfgdef.Error(currentPos, "没找到", gen.fieldPath(), field.FTable, text)
+	} else if set.table != "" {
+		gen.addRef(set, raw)
+	}
+}
+
+//记录当前字段对关联表格数据行的引用
+func (gen *JSONGen) addRef(set *keySet, raw string) {
+	gen.cfgMap.Refs = append(gen.cfgMap.Refs, &cfgdef.RefItem{
+		Table: set.table,
+		Key:   raw,
+		From:  gen.rowPath,
+		Field: gen.fieldPath(),
+		Pos:   gen.rowPos,
+	})
+}
+
+//外键关联的值, 找不到关联表时只报告一次错误
+func (gen *JSONGen) getKeySet(ftable string) *keySet {
+	if set, ok := gen.keySets[ftable]; ok {
+		return set
+	}
+	set := gen.loadKeySet(ftable)
+	gen.keySets[ftable] = set
+	return set
+}
+
+func (gen *JSONGen) loadKeySet(ftable string) *keySet {
+	name, fieldName := ftable, ""
+	if n := strings.Index(ftable, "."); n >= 0 {
+		name, fieldName = ftable[:n], ftable[n+1:]
+	}
+
+	if enumDef, ok := gen.cfgMap.EnumMap[name]; ok && fieldName == "" {
+		set := &keySet{field: &cfgdef.FieldDef{Type: name, IsEnum: true}, keys: make(map[string]string)}
+		for _, item := range enumDef.Items {
+			set.keys[gen.NormalizeKey(item.Value, set.field)] = item.Name
+		}
+		return set
+	}
+
+	tableDef, ok := gen.cfgMap.TableMap[name]
+	if !ok && fieldName == "" {
+		name += "Table"
+		tableDef, ok = gen.cfgMap.TableMap[name]
+	}
+	if !ok {
+		cfgdef.Error("缺少外键关联表", ftable)
+		return nil
+	}
+	col := tableDef.Key
+	if fieldName != "" {
+		col = -1
+		for i, f := range tableDef.Fields {
+			if f.Name == fieldName {
+				col = i
 			}
 		}
-	} else {
-		fmt.Println("error: 缺少外键关联表", field.FTable)
+		if col < 0 {
+			cfgdef.Error("外键关联表没有字段", ftable)
+			return nil
+		}
+	} else if col < 0 {
+		cfgdef.Error("外键关联表没有主键", ftable)
+		return nil
+	}
+	if len(tableDef.Data) == 0 {
+		cfgdef.Error("外键关联表没有数据", ftable)
+		return nil
 	}
+
+	set := &keySet{field: tableDef.Fields[col], keys: make(map[string]string)}
+	if fieldName == "" {
+		set.table = name
+	}
+	for i := 0; i < len(tableDef.Data); i++ {
+		cell := cfgdef.Trim(tableDef.Data[i][col])
+		if set.field.IsArray {
+			var values []interface{}
+			d := json.NewDecoder(strings.NewReader(cell))
+			d.UseNumber()
+			d.Decode(&values)
+			for _, v := range values {
+				set.keys[gen.NormalizeKey(fmt.Sprint(v), set.field)] = fmt.Sprint(v)
+			}
+		} else {
+			set.keys[gen.NormalizeKey(cell, set.field)] = cell
+		}
+	}
+	return set
+}
+
+// NormalizeKey 按照关联字段的类型规范化值, 整数统一为十进制, 枚举名转换为枚举值
+func (gen *JSONGen) NormalizeKey(s string, keyField *cfgdef.FieldDef) string {
+	s = cfgdef.Trim(s)
+	if keyField.IsEnum {
+		if enumDef, ok := gen.cfgMap.EnumMap[keyField.Type]; ok {
+			if item, ok := enumDef.ItemsMap[s]; ok {
+				s = item.Value
+			}
+		}
+		if n, err := strconv.ParseInt(s, 0, 64); err == nil {
+			return strconv.FormatInt(n, 10)
+		}
+		return s
+	}
+	switch keyField.Type {
+	case "int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64":
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return strconv.FormatInt(n, 10)
+		}
+		if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return strconv.FormatUint(n, 10)
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil && f == math.Trunc(f) {
+			return strconv.FormatFloat(f, 'f', -1, 64)
+		}
+	case "float32", "float64":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return strconv.FormatFloat(f, 'f', -1, 64)
+		}
+	}
+	return s
+}
+
+//当前字段在数据行中的路径, 如: Rewards[2].ItemID
+func (gen *JSONGen) fieldPath() string {
+	return strings.TrimPrefix(gen.textPath, gen.rowPath+".")
 }
 
 //取值范围检查
 func (gen *JSONGen) checkRange(s string, field *cfgdef.FieldDef) {
 	var v float64
 	if json.Unmarshal([]byte(s), &v) == nil {
+		if field.Type == "fixed" {
+			v /= float64(uint64(1) << cfgdef.ExportFlags.FixedBits)
+		}
 		ok := true
 		if len(field.Range) == 1 {
 			if v > field.Range[0] {
@@ -462,10 +1197,10 @@ func (gen *JSONGen) checkRange(s string, field *cfgdef.FieldDef) {
 			}
 		}
 		if !ok {
-			fmt.Println("error: 字段取值范围错误", field.Name, field.Range, s)
+			cfgdef.Error(currentPos, "字段取值范围错误", gen.fieldPath(), field.Range, s)
 		}
 	} else {
-		fmt.Println("error: 字段值填写错误", field.Name, s)
+		cfgdef.Error(currentPos, "字段值填写错误", gen.fieldPath(), s)
 	}
 }
 
@@ -474,7 +1209,7 @@ func (gen *JSONGen) checkLen(s string, field *cfgdef.FieldDef) {
 	if field.IsArray {
 		var varr []cfgdef.AnyField
 		if err := json.Unmarshal([]byte(s), &varr); err != nil {
-			fmt.Println("error:", err)
+			cfgdef.Error(err)
 		} else {
 			ok := true
 			l := uint(len(varr))
@@ -488,14 +1223,14 @@ func (gen *JSONGen) checkLen(s string, field *cfgdef.FieldDef) {
 				}
 			}
 			if !ok {
-				fmt.Println("error: 字符串长度范围错误", field.Name, field.Len, s, l)
+				cfgdef.Error(currentPos, "字符串长度范围错误", gen.fieldPath(), field.Len, s, l)
 			}
 		}
 	} else if field.Type == "string" {
 		ok := true
 		v := ""
 		json.Unmarshal([]byte(s), &v)
-		l := uint(len(v))
+		l := uint(utf8.RuneCountInString(v))
 		if len(field.Len) == 1 {
 			if l > field.Len[0] {
 				ok = false
@@ -506,7 +1241,7 @@ func (gen *JSONGen) checkLen(s string, field *cfgdef.FieldDef) {
 			}
 		}
 		if !ok {
-			fmt.Println("error: 字符串长度范围错误", field.Name, field.Len, v, l)
+			cfgdef.Error(currentPos, "字符串长度范围错误", gen.fieldPath(), field.Len, v, l)
 		}
 	}
 }
@@ -518,28 +1253,238 @@ func (gen *JSONGen) checkArray(s string, field *cfgdef.FieldDef) {
 	}
 	var va []cfgdef.AnyField
 	if err := json.Unmarshal([]byte(s), &va); err != nil {
-		fmt.Println("error:", err)
+		cfgdef.Error(err)
 	} else {
-		for _, v := range va {
-			if field.FTable != "" {
-				gen.checkFTable(v.Value, field)
-			}
-			if field.Range != nil {
-				gen.checkRange(v.Value, field)
-			}
+		path := gen.textPath
+		for i, v := range va {
+			gen.textPath = path + "[" + strconv.Itoa(i) + "]"
+			gen.checkElement(v.Value, field)
 		}
+		gen.textPath = path
+	}
+}
+
+//检查字段, 结构体的字段在生成结构体时检查
+func (gen *JSONGen) checkField(s string, field *cfgdef.FieldDef) {
+	if field.IsArray {
+		gen.checkArray(s, field)
+	} else if !field.IsStruct && !field.IsUnion {
+		gen.checkValue(s, field)
 	}
 }
 
 //检查字段值
 func (gen *JSONGen) checkValue(s string, field *cfgdef.FieldDef) {
+	gen.checkElement(s, field)
+	if field.Len != nil && field.Type != "text" {
+		gen.checkLen(s, field)
+	}
+}
+
+//检查单个值, 数组字段检查每个元素
+func (gen *JSONGen) checkElement(s string, field *cfgdef.FieldDef) {
 	if field.FTable != "" {
 		gen.checkFTable(s, field)
 	}
 	if field.Range != nil {
 		gen.checkRange(s, field)
 	}
-	if field.Len != nil {
-		gen.checkLen(s, field)
+	if field.Type == "string" {
+		var v string
+		if json.Unmarshal([]byte(s), &v) == nil {
+			gen.checkString(v, field)
+		}
+	} else if field.In != nil && field.Type != "text" {
+		gen.checkIn(s, field)
+	}
+}
+
+//检查字符串的显示宽度、格式、可选值、文件路径, 本地化文本检查源语言文本
+func (gen *JSONGen) checkString(v string, field *cfgdef.FieldDef) {
+	if field.Width != nil {
+		ok := true
+		w := uint(cfgdef.GetDisplayWidth(v))
+		if len(field.Width) == 1 {
+			ok = w <= field.Width[0]
+		} else if len(field.Width) > 1 {
+			ok = w >= field.Width[0] && w <= field.Width[1]
+		}
+		if !ok {
+			cfgdef.Error(currentPos, "字符串显示宽度范围错误", gen.fieldPath(), field.Width, v, w)
+		}
+	}
+	if field.Pattern != "" {
+		re, ok := gen.patterns[field.Pattern]
+		if !ok {
+			//正则表达式需要完整匹配, 无效的正则表达式在加载时已经报告
+			re, _ = regexp.Compile("^(?:" + field.Pattern + ")$")
+			gen.patterns[field.Pattern] = re
+		}
+		if re != nil && !re.MatchString(v) {
+			cfgdef.Error(currentPos, "字符串格式错误", gen.fieldPath(), field.Pattern, v)
+		}
+	}
+	if field.In != nil {
+		gen.checkIn(toStringValue(v), field)
+	}
+	if field.PathRoot != "" && v != "" {
+		p := filepath.Join(field.PathRoot, filepath.FromSlash(v))
+		if info, err := os.Stat(p); err != nil || info.IsDir() {
+			cfgdef.Error(currentPos, "文件不存在", gen.fieldPath(), p)
+		}
+	}
+	if field.Asset != nil && v != "" && cfgdef.ExportFlags.AssetPath != "" {
+		gen.checkAsset(v, field.Asset)
+	}
+}
+
+//资源引用检查, 不存在的资源记录下来, 单元格检查完后一起报告
+func (gen *JSONGen) checkAsset(v string, asset *cfgdef.AssetDef) {
+	name := path.Join(asset.Root, strings.ReplaceAll(v, "\\", "/"))
+	candidates := []string{name}
+	if len(asset.Exts) > 0 {
+		ext := strings.ToLower(path.Ext(name))
+		candidates = nil
+		for _, e := range asset.Exts {
+			if ext == e {
+				candidates = []string{name}
+				break
+			}
+			candidates = append(candidates, name+e)
+		}
+	}
+	for _, c := range candidates {
+		p := filepath.Join(cfgdef.ExportFlags.AssetPath, filepath.FromSlash(c))
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			if cfgdef.ExportFlags.AssetMeta {
+				if _, err := os.Stat(p + ".meta"); err != nil {
+					gen.assets = append(gen.assets, gen.fieldPath()+": "+c+"(缺少.meta)")
+				}
+			}
+			return
+		}
+	}
+	gen.assets = append(gen.assets, gen.fieldPath()+": "+name)
+}
+
+//可选值检查, 枚举字段可以填写枚举项名称
+func (gen *JSONGen) checkIn(s string, field *cfgdef.FieldDef) {
+	var v interface{}
+	json.Unmarshal([]byte(s), &v)
+	for _, item := range field.In {
+		switch x := v.(type) {
+		case string:
+			if x == item {
+				return
+			}
+		case bool:
+			if strconv.FormatBool(x) == item {
+				return
+			}
+		case float64:
+			if enumDef, ok := gen.cfgMap.EnumMap[field.Type]; ok && field.IsEnum {
+				if enumItem, ok := enumDef.ItemsMap[item]; ok {
+					if n, err := strconv.ParseInt(enumItem.Value, 0, 64); err == nil && float64(n) == x {
+						return
+					}
+				}
+			}
+			if f, err := strconv.ParseFloat(item, 64); err == nil && f == x {
+				return
+			}
+		}
+	}
+	cfgdef.Error(currentPos, "字段值不在可选值中", gen.fieldPath(), field.In, s)
+}
+
+// CheckRules 使用生成的数据检查校验规则, 需要先生成全部表格
+func (gen *JSONGen) CheckRules() {
+	for _, rule := range gen.cfgMap.Rules {
+		expr, err := cfgexpr.Compile(rule.Expr)
+		if err != nil {
+			cfgdef.Errorf("%s 规则错误: %s %v\n", rule.Pos, rule.Expr, err)
+			continue
+		}
+		if rule.Table == "" {
+			gen.checkRule(expr, rule, nil, nil)
+			continue
+		}
+		tableDef, ok := gen.cfgMap.TableMap[rule.Table]
+		if !ok || strings.HasSuffix(rule.Table, "Struct") {
+			cfgdef.Errorf("%s 规则的表格未定义: %s\n", rule.Pos, rule.Table)
+			continue
+		}
+		for i, row := range gen.getTable(rule.Table).Rows {
+			//名称未定义时每一行都会出错, 只报告一次
+			if !gen.checkRule(expr, rule, row, tableDef.DataPos[i]) {
+				break
+			}
+		}
+	}
+}
+
+//对一行数据检查规则, 全局规则的数据行为nil, 表达式中有未定义的名称时返回false
+func (gen *JSONGen) checkRule(expr *cfgexpr.Expr, rule *cfgdef.RuleDef, row map[string]interface{}, rowPos *cfgdef.RowPos) bool {
+	pos := rule.Pos
+	if rowPos != nil {
+		pos = rowPos.String() + " [" + rule.Pos + "]"
+	}
+	env := &cfgexpr.Env{Row: row, Globals: gen.getGlobal}
+	ok, trace, err := expr.Check(env)
+	if err != nil {
+		cfgdef.Errorf("%s 规则求值失败: %s %v\n", pos, rule.Expr, err)
+		var undefined *cfgexpr.UndefinedError
+		return !errors.As(err, &undefined)
+	} else if !ok {
+		cfgdef.Errorf("%s 规则不满足: %s %s (%s)\n", pos, rule.Expr, rule.Desc, trace)
+	}
+	return true
+}
+
+//获得表达式中的全局名称: 表格、设置、枚举
+func (gen *JSONGen) getGlobal(name string) (interface{}, bool) {
+	if enumDef, ok := gen.cfgMap.EnumMap[name]; ok {
+		enum := make(cfgexpr.Enum)
+		for _, item := range enumDef.ItemsMap {
+			v, _ := strconv.ParseInt(item.Value, 0, 64)
+			enum[item.Name] = float64(v)
+		}
+		return enum, true
+	}
+	if _, ok := gen.cfgMap.TableMap[name]; !ok {
+		return nil, false
+	}
+	if strings.HasSuffix(name, "Settings") {
+		if t := gen.getTable(name); len(t.Rows) > 0 {
+			return t.Rows[0], true
+		}
+		return nil, true
+	} else if strings.HasSuffix(name, "Table") {
+		return gen.getTable(name), true
+	}
+	return nil, false
+}
+
+//获得解析后的表格数据, 没有导出的字段为nil
+func (gen *JSONGen) getTable(name string) *cfgexpr.Table {
+	if t, ok := gen.tables[name]; ok {
+		return t
+	}
+	tableDef := gen.cfgMap.TableMap[name]
+	t := &cfgexpr.Table{Keys: make(map[string]map[string]interface{})}
+	for i, s := range gen.rows[name] {
+		row := make(map[string]interface{})
+		json.Unmarshal([]byte(s), &row)
+		for _, field := range tableDef.Fields {
+			if _, ok := row[field.Name]; !ok && field.Name != "" {
+				row[field.Name] = nil
+			}
+		}
+		t.Rows = append(t.Rows, row)
+		if tableDef.Key >= 0 {
+			t.Keys[cfgdef.Trim(tableDef.Data[i][tableDef.Key])] = row
+		}
 	}
+	gen.tables[name] = t
+	return t
 }
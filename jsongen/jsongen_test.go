@@ -0,0 +1,204 @@
+package jsongen
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/gamewheels/cfgwheel/cfgdef"
+)
+
+// newTable 构建测试用的表格定义
+func newTable(cfgMap *cfgdef.CfgMap, name string, fields ...*cfgdef.FieldDef) *cfgdef.TableDef {
+	tableDef := cfgdef.NewTableDef(name)
+	for i, field := range fields {
+		if field.UseFor == "" {
+			field.UseFor = "A"
+		}
+		if field.IsKey {
+			tableDef.Key = i
+		}
+		tableDef.Fields[i] = field
+		tableDef.FieldsMap[field.Name] = field
+	}
+	cfgMap.TableMap[name] = tableDef
+	return tableDef
+}
+
+// addRow 添加一行数据
+func addRow(tableDef *cfgdef.TableDef, cells ...string) {
+	n := len(tableDef.Data)
+	tableDef.Data[n] = cells
+	tableDef.DataPos[n] = &cfgdef.RowPos{File: "test.xlsx", Sheet: tableDef.Name, Row: n + 5}
+	if tableDef.Key >= 0 {
+		tableDef.DataMap[cells[tableDef.Key]] = cells
+		tableDef.KeyRows[cells[tableDef.Key]] = n
+	}
+}
+
+// newEnum 构建测试用的枚举, 枚举值依次为1, 2, 3...
+func newEnum(cfgMap *cfgdef.CfgMap, name string, items ...string) *cfgdef.EnumDef {
+	enumDef := cfgdef.NewEnumDef(name)
+	for i, n := range items {
+		item := &cfgdef.EnumItem{Name: n, Value: strconv.Itoa(i + 1)}
+		enumDef.Items[i] = item
+		enumDef.ItemsMap[n] = item
+	}
+	cfgMap.EnumMap[name] = enumDef
+	return enumDef
+}
+
+// newFlags 构建测试用的标记枚举, 枚举值依次为1, 2, 4...
+func newFlags(cfgMap *cfgdef.CfgMap, name string, items ...string) *cfgdef.EnumDef {
+	enumDef := newEnum(cfgMap, name, items...)
+	enumDef.IsFlags = true
+	enumDef.Type = "uint32"
+	for i, item := range enumDef.Items {
+		item.Value = strconv.Itoa(1 << i)
+	}
+	return enumDef
+}
+
+// newTestCfg 构建测试用的配置: 枚举、结构体和联合体
+func newTestCfg() *cfgdef.CfgMap {
+	cfgMap := cfgdef.NewCfgMap()
+	newEnum(cfgMap, "ColorEnum", "Red", "Green", "Blue")
+	newFlags(cfgMap, "ElementFlags", "Fire", "Ice", "Wind")
+	newEnum(cfgMap, "EffectTypeEnum", "Paint", "Element", "None")
+	newTable(cfgMap, "ColorStruct",
+		&cfgdef.FieldDef{Name: "Color", Type: "ColorEnum", IsEnum: true},
+		&cfgdef.FieldDef{Name: "Tints", Type: "ColorEnum", IsEnum: true, IsArray: true})
+	newTable(cfgMap, "PaintStruct",
+		&cfgdef.FieldDef{Name: "Color", Type: "ColorEnum", IsEnum: true})
+	newTable(cfgMap, "ElementStruct",
+		&cfgdef.FieldDef{Name: "Elem", Type: "ElementFlags", IsEnum: true},
+		&cfgdef.FieldDef{Name: "Resists", Type: "ElementFlags", IsEnum: true, IsArray: true})
+	unionDef := cfgdef.NewUnionDef("EffectUnion")
+	unionDef.Enum = "EffectTypeEnum"
+	for i, item := range []*cfgdef.UnionItem{{Name: "Paint", Struct: "PaintStruct"}, {Name: "Element", Struct: "ElementStruct"}, {Name: "None"}} {
+		unionDef.Items[i] = item
+		unionDef.ItemsMap[item.Name] = item
+	}
+	cfgMap.UnionMap[unionDef.Name] = unionDef
+	return cfgMap
+}
+
+// fieldTests 字段定义、单元格及其期望的JSON值, bad为true时期望报告错误
+type fieldTests []struct {
+	name  string
+	field cfgdef.FieldDef
+	cell  string
+	want  string
+	bad   bool
+}
+
+func (tests fieldTests) run(t *testing.T, cfgMap *cfgdef.CfgMap) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			field := tt.field
+			field.Name = "V"
+			tableDef := newTable(cfgMap, "TestTable",
+				&cfgdef.FieldDef{Name: "ID", Type: "uint32", IsKey: true}, &field)
+			addRow(tableDef, "1", tt.cell)
+
+			errorCount := cfgdef.ErrorCount
+			got := NewJSONGen(cfgMap).GenTable("TestTable")
+			if bad := cfgdef.ErrorCount > errorCount; bad != tt.bad {
+				t.Errorf("cell %s: reported error = %v, want %v", tt.cell, bad, tt.bad)
+			}
+			if want := `[{"ID":1,"V":` + tt.want + `}]`; !tt.bad && got != want {
+				t.Errorf("cell %s:\n got %s\nwant %s", tt.cell, got, want)
+			}
+		})
+	}
+}
+
+// TestEnumValues 数组元素、结构体字段和联合体数据中的枚举转换为枚举值
+func TestEnumValues(t *testing.T) {
+	colorEnum := cfgdef.FieldDef{Type: "ColorEnum", IsEnum: true}
+	colorArray := cfgdef.FieldDef{Type: "ColorEnum", IsEnum: true, IsArray: true}
+	colorStruct := cfgdef.FieldDef{Type: "ColorStruct", IsStruct: true}
+	fieldTests{
+		{"enum", colorEnum, "Green", "2", false},
+		{"enum default", colorEnum, "", "1", false},
+		{"enum undefined", colorEnum, "Pink", "", true},
+		{"enum array", colorArray, `["Red", "Blue"]`, "[1,3]", false},
+		{"enum array value", colorArray, `[2, "Green"]`, "[2,2]", false},
+		{"enum array empty", colorArray, "", "[]", false},
+		{"enum array undefined", colorArray, `["Red", "Pink"]`, "", true},
+		{"enum array undefined value", colorArray, `[9]`, "", true},
+		{"enum array in", cfgdef.FieldDef{Type: "ColorEnum", IsEnum: true, IsArray: true, In: []string{"Red", "Green"}}, `["Blue"]`, "", true},
+		{"struct", colorStruct, `["Blue", ["Red", "Green"]]`, `{"Color":3,"Tints":[1,2]}`, false},
+		{"struct object", colorStruct, `{"Color": "Green"}`, `{"Color":2}`, false},
+		{"struct undefined", colorStruct, `["Pink"]`, "", true},
+		{"struct array", cfgdef.FieldDef{Type: "ColorStruct", IsStruct: true, IsArray: true}, `[["Red"], ["Blue", ["Blue"]]]`, `[{"Color":1},{"Color":3,"Tints":[3]}]`, false},
+		{"union", cfgdef.FieldDef{Type: "EffectUnion", IsUnion: true}, `["Paint", "Blue"]`, `{"Type":1,"Data":{"Color":3}}`, false},
+		{"union object", cfgdef.FieldDef{Type: "EffectUnion", IsUnion: true}, `{"Type": "Paint", "Color": "Green"}`, `{"Type":1,"Data":{"Color":2}}`, false},
+		{"union undefined", cfgdef.FieldDef{Type: "EffectUnion", IsUnion: true}, `["Paint", "Pink"]`, "", true},
+	}.run(t, newTestCfg())
+}
+
+// TestFlagsValues 数组元素、结构体字段和联合体数据中的标记枚举支持 Fire|Ice 写法
+func TestFlagsValues(t *testing.T) {
+	flags := cfgdef.FieldDef{Type: "ElementFlags", IsEnum: true}
+	flagsArray := cfgdef.FieldDef{Type: "ElementFlags", IsEnum: true, IsArray: true}
+	elemStruct := cfgdef.FieldDef{Type: "ElementStruct", IsStruct: true}
+	elemUnion := cfgdef.FieldDef{Type: "EffectUnion", IsUnion: true}
+	fieldTests{
+		{"flags", flags, "Fire | Wind", "5", false},
+		{"flags empty", flags, "", "0", false},
+		{"flags undefined", flags, "Fire|Fog", "", true},
+		{"flags array", flagsArray, `["Fire|Ice", "Wind", ""]`, "[3,4,0]", false},
+		{"flags array value", flagsArray, `[7, "Ice"]`, "[7,2]", false},
+		{"flags array undefined", flagsArray, `["Ice|Fog"]`, "", true},
+		{"flags array undefined bit", flagsArray, `[8]`, "", true},
+		{"struct", elemStruct, `["Ice|Wind", ["Fire", "Fire|Ice"]]`, `{"Elem":6,"Resists":[1,3]}`, false},
+		{"struct object", elemStruct, `{"Elem": "Fire|Ice|Wind"}`, `{"Elem":7}`, false},
+		{"struct undefined", elemStruct, `["Fog"]`, "", true},
+		{"union", elemUnion, `["Element", "Fire|Wind"]`, `{"Type":2,"Data":{"Elem":5}}`, false},
+		{"union object", elemUnion, `{"Type": "Element", "Resists": ["Ice|Wind"]}`, `{"Type":2,"Data":{"Resists":[6]}}`, false},
+	}.run(t, newTestCfg())
+}
+
+// TestRefsIgnoreUseFor 没有导出的字段也收集外键引用, 包括结构体和联合体中的字段
+func TestRefsIgnoreUseFor(t *testing.T) {
+	flags := cfgdef.ExportFlags
+	defer func() { cfgdef.ExportFlags = flags }()
+	cfgdef.ExportFlags.UseFor = "S"
+
+	cfgMap := newTestCfg()
+	items := newTable(cfgMap, "ItemTable", &cfgdef.FieldDef{Name: "ID", Type: "uint32", IsKey: true})
+	for _, key := range []string{"1", "2", "3", "4", "5"} {
+		addRow(items, key)
+	}
+	newTable(cfgMap, "RewardStruct",
+		&cfgdef.FieldDef{Name: "ItemID", Type: "uint32", FTable: "Item"},
+		&cfgdef.FieldDef{Name: "Count", Type: "int32"})
+	cfgMap.UnionMap["EffectUnion"].ItemsMap["Paint"].Struct = "RewardStruct"
+	shop := newTable(cfgMap, "ShopTable",
+		&cfgdef.FieldDef{Name: "ID", Type: "uint32", IsKey: true},
+		&cfgdef.FieldDef{Name: "ItemID", Type: "uint32", FTable: "Item", UseFor: "S"},
+		&cfgdef.FieldDef{Name: "IconItem", Type: "uint32", FTable: "Item", UseFor: "C"},
+		&cfgdef.FieldDef{Name: "Rewards", Type: "RewardStruct", IsStruct: true, IsArray: true, UseFor: "C"},
+		&cfgdef.FieldDef{Name: "Effect", Type: "EffectUnion", IsUnion: true, UseFor: "C"})
+	addRow(shop, "1", "1", "2", `[[3, 1], {"ItemID": 0}]`, `["Paint", 4]`)
+
+	got := NewJSONGen(cfgMap).GenTable("ShopTable")
+	if want := `[{"ID":1,"ItemID":1}]`; got != want {
+		t.Errorf("GenTable = %s, want %s", got, want)
+	}
+	refs := make(map[string]string)
+	for _, ref := range cfgMap.Refs {
+		refs[ref.Field] = ref.Table + "." + ref.Key
+	}
+	want := map[string]string{
+		"ItemID":            "ItemTable.1",
+		"IconItem":          "ItemTable.2",
+		"Rewards[0].ItemID": "ItemTable.3",
+		"Effect.ItemID":     "ItemTable.4",
+	}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("Refs = %v, want %v", refs, want)
+	}
+}
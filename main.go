@@ -7,12 +7,17 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/gamewheels/cfgwheel/cfgdef"
 	"github.com/gamewheels/cfgwheel/cppgen"
 	"github.com/gamewheels/cfgwheel/csgen"
 	"github.com/gamewheels/cfgwheel/gogen"
+	"github.com/gamewheels/cfgwheel/i18n"
 	"github.com/gamewheels/cfgwheel/jsongen"
 	"github.com/gamewheels/cfgwheel/unitygen"
 	"github.com/tealeg/xlsx"
@@ -22,20 +27,25 @@ import (
 var xlsMap = make(map[int]string)
 var cfgMap = cfgdef.NewCfgMap()
 
-// loadXlsList 加载Excel配置文件列表
-func loadXlsList(pathname string) {
+// loadXlsList 加载Excel配置文件列表, 路径不存在或者无法读取时返回错误
+func loadXlsList(pathname string) error {
 	fileInfo, err := os.Stat(pathname)
 	if err != nil {
-		return
+		return err
 	}
 
 	if fileInfo.IsDir() {
-		all, _ := ioutil.ReadDir(pathname)
+		all, err := ioutil.ReadDir(pathname)
+		if err != nil {
+			return err
+		}
 		for _, f := range all {
 			fn := f.Name()
 			ext := strings.ToLower(path.Ext(fn))
 			if f.IsDir() {
-				loadXlsList(pathname + "/" + fn)
+				if err := loadXlsList(pathname + "/" + fn); err != nil {
+					return err
+				}
 			} else if !strings.HasPrefix(fn, "~$") &&
 				(ext == ".xls" || ext == ".xlsx") {
 				xlsMap[len(xlsMap)] = pathname + "/" + fn
@@ -44,6 +54,7 @@ func loadXlsList(pathname string) {
 	} else {
 		xlsMap[len(xlsMap)] = pathname
 	}
+	return nil
 }
 
 func lineTrim(s string) string {
@@ -51,43 +62,283 @@ func lineTrim(s string) string {
 }
 
 // loadEnumCfg 加载枚举配置
-func loadEnumCfg(sheet *xlsx.Sheet) {
-	name := sheet.Name
+func loadEnumCfg(filepath string, sheet *xlsx.Sheet) {
+	name := cfgdef.GetSheetName(sheet.Name)
 	if sheet.MaxCol < 3 || sheet.MaxRow < 3 {
-		fmt.Println("error: enum", name, "格式不正确")
+		cfgdef.Error("enum", name, "格式不正确")
 		return
 	}
 	if _, ok := cfgMap.EnumMap[name]; ok {
-		fmt.Println("error: enum", name, "重复定义")
+		cfgdef.Error("enum", name, "重复定义")
 		return
 	}
 	enumDef := cfgdef.NewEnumDef(name)
 	enumDef.Desc = lineTrim(sheet.Rows[0].Cells[0].String())
+	enumDef.IsFlags = strings.HasSuffix(name, "Flags")
+
+	//底层整数类型, 填写在描述右侧的单元格中, 标记枚举默认为uint32
+	if len(sheet.Rows[0].Cells) > 1 {
+		enumDef.Type = cfgdef.GetFullFieldType(sheet.Rows[0].Cells[1].String())
+	}
+	if enumDef.Type == "" && enumDef.IsFlags {
+		enumDef.Type = "uint32"
+	}
+	bits, signed := 32, true
+	if enumDef.Type != "" {
+		bits, signed = cfgdef.GetIntTypeBits(enumDef.Type)
+		if bits == 0 || (enumDef.IsFlags && signed) {
+			cfgdef.Error("enum", name, "底层类型无效", enumDef.Type)
+			return
+		}
+	}
+
+	values := make(map[string]string)
+	var mask uint64
+	last := ""
 	for i := 2; i < sheet.MaxRow; i++ {
 		cells := sheet.Rows[i].Cells
-		if len(cells) > 2 && cells[0].String() != "" && cells[1].String() != "" {
-			item := &cfgdef.EnumItem{
-				Name:  cfgdef.Trim(cells[0].String()),
-				Value: cfgdef.Trim(cells[1].String()),
-				Desc:  lineTrim(cells[2].String()),
+		if len(cells) == 0 || cfgdef.Trim(cells[0].String()) == "" {
+			continue
+		}
+		item := &cfgdef.EnumItem{
+			Name: cfgdef.Trim(cells[0].String()),
+		}
+		if len(cells) > 1 {
+			item.Value = cfgdef.Trim(cells[1].String())
+		}
+		if len(cells) > 2 {
+			item.Desc = lineTrim(cells[2].String())
+		}
+		pos := &cfgdef.RowPos{File: filepath, Sheet: sheet.Name, Row: i}
+
+		//未填写值时自动编号, 标记枚举取下一个未使用的位
+		if item.Value == "" {
+			switch {
+			case enumDef.IsFlags:
+				next := uint64(1)
+				for next&mask != 0 {
+					next <<= 1
+				}
+				item.Value = strconv.FormatUint(next, 10)
+			case last == "":
+				item.Value = "0"
+			case signed:
+				v, _ := strconv.ParseInt(last, 10, 64)
+				item.Value = strconv.FormatInt(v+1, 10)
+			default:
+				v, _ := strconv.ParseUint(last, 10, 64)
+				item.Value = strconv.FormatUint(v+1, 10)
 			}
-			enumDef.Items[len(enumDef.Items)] = item
-			enumDef.ItemsMap[item.Name] = item
 		}
+		value, err := parseEnumValue(item.Value, bits, signed)
+		if err != nil {
+			cfgdef.Error("enum", name, "枚举值无效", item.Name, item.Value, pos.Cell(1))
+			continue
+		}
+		item.Value = value
+		if _, ok := enumDef.ItemsMap[item.Name]; ok {
+			cfgdef.Error("enum", name, "枚举名重复", item.Name, pos.Cell(0))
+			continue
+		}
+		if n, ok := values[value]; ok {
+			cfgdef.Error("enum", name, "枚举值重复", n, item.Name, value, pos.Cell(1))
+			continue
+		}
+		if enumDef.IsFlags {
+			v, _ := strconv.ParseUint(value, 10, 64)
+			mask |= v
+		}
+		values[value] = item.Name
+		last = value
+		enumDef.Items[len(enumDef.Items)] = item
+		enumDef.ItemsMap[item.Name] = item
 	}
 	cfgMap.EnumMap[name] = enumDef
 }
 
+// parseEnumValue 解析枚举值, 支持十进制和0x开头的十六进制, 返回十进制表示
+func parseEnumValue(s string, bits int, signed bool) (string, error) {
+	base := 10
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		base = 16
+		s = s[2:]
+	}
+	if signed {
+		v, err := strconv.ParseInt(s, base, bits)
+		return strconv.FormatInt(v, 10), err
+	}
+	v, err := strconv.ParseUint(s, base, bits)
+	return strconv.FormatUint(v, 10), err
+}
+
+// loadUnionCfg 加载联合体配置
+func loadUnionCfg(sheet *xlsx.Sheet) {
+	name := cfgdef.GetSheetName(sheet.Name)
+	if sheet.MaxCol < 3 || sheet.MaxRow < 3 {
+		cfgdef.Error("union", name, "格式不正确")
+		return
+	}
+	if _, ok := cfgMap.UnionMap[name]; ok {
+		cfgdef.Error("union", name, "重复定义")
+		return
+	}
+	unionDef := cfgdef.NewUnionDef(name)
+	unionDef.Desc = lineTrim(sheet.Rows[0].Cells[0].String())
+	//判别枚举, 未填写时默认为 XxxTypeEnum
+	if len(sheet.Rows[0].Cells) > 1 {
+		unionDef.Enum = cfgdef.Trim(sheet.Rows[0].Cells[1].String())
+	}
+	if unionDef.Enum == "" {
+		unionDef.Enum = name[:len(name)-5] + "TypeEnum"
+	}
+	for i := 2; i < sheet.MaxRow; i++ {
+		cells := sheet.Rows[i].Cells
+		if len(cells) > 2 && cells[0].String() != "" {
+			item := &cfgdef.UnionItem{
+				Name:   cfgdef.Trim(cells[0].String()),
+				Struct: cfgdef.Trim(cells[1].String()),
+				Desc:   lineTrim(cells[2].String()),
+			}
+			if _, ok := unionDef.ItemsMap[item.Name]; ok {
+				cfgdef.Error("union", name, "变体重复定义", item.Name)
+				continue
+			}
+			unionDef.Items[len(unionDef.Items)] = item
+			unionDef.ItemsMap[item.Name] = item
+		}
+	}
+	cfgMap.UnionMap[name] = unionDef
+}
+
+// loadRulesCfg 加载校验规则, 每行为: 表格, 表达式, 描述
+func loadRulesCfg(filepath string, sheet *xlsx.Sheet) {
+	name := cfgdef.GetSheetName(sheet.Name)
+	if sheet.MaxCol < 2 {
+		cfgdef.Error("rules", name, "格式不正确")
+		return
+	}
+	pos := &cfgdef.RowPos{File: filepath, Sheet: sheet.Name}
+	for i := 2; i < sheet.MaxRow; i++ {
+		cells := sheet.Rows[i].Cells
+		if len(cells) < 2 || cfgdef.Trim(cells[1].String()) == "" {
+			continue
+		}
+		pos.Row = i
+		rule := &cfgdef.RuleDef{
+			Table: cfgdef.Trim(cells[0].String()),
+			Expr:  cfgdef.Trim(cells[1].String()),
+			Pos:   pos.Cell(1),
+		}
+		if len(cells) > 2 {
+			rule.Desc = lineTrim(cells[2].String())
+		}
+		cfgMap.Rules = append(cfgMap.Rules, rule)
+	}
+}
+
+// checkUnionCfg 检查联合体的判别枚举和数据结构体
+func checkUnionCfg() {
+	for name, unionDef := range cfgMap.UnionMap {
+		enumDef, ok := cfgMap.EnumMap[unionDef.Enum]
+		if !ok {
+			cfgdef.Error("union", name, "缺少判别枚举", unionDef.Enum)
+			continue
+		}
+		for i := 0; i < len(unionDef.Items); i++ {
+			item := unionDef.Items[i]
+			if _, ok := enumDef.ItemsMap[item.Name]; !ok {
+				cfgdef.Error("union", name, "枚举项未定义", unionDef.Enum+"."+item.Name)
+			}
+			if item.Struct == "" {
+				continue
+			}
+			if _, ok := cfgMap.TableMap[item.Struct]; !ok || !strings.HasSuffix(item.Struct, "Struct") {
+				cfgdef.Error("union", name, "数据结构体未定义", item.Struct)
+			}
+		}
+	}
+}
+
+// parseInValues 解析可选值列表, 支持JSON数组或者逗号分隔
+func parseInValues(s string) []string {
+	var values []interface{}
+	if json.Unmarshal([]byte(s), &values) != nil {
+		values = nil
+		for _, v := range strings.Split(s[1:len(s)-1], ",") {
+			values = append(values, cfgdef.Trim(v))
+		}
+	}
+	list := make([]string, len(values))
+	for i, v := range values {
+		list[i] = fmt.Sprint(v)
+	}
+	return list
+}
+
+// parseAssetDef 解析资源引用约束, 第一项为根目录, 其余为扩展名
+func parseAssetDef(s string) *cfgdef.AssetDef {
+	asset := &cfgdef.AssetDef{}
+	for i, v := range strings.Split(s, ",") {
+		v = strings.ReplaceAll(cfgdef.Trim(v), "\\", "/")
+		if i == 0 {
+			asset.Root = strings.Trim(v, "/")
+		} else if v != "" {
+			if !strings.HasPrefix(v, ".") {
+				v = "." + v
+			}
+			asset.Exts = append(asset.Exts, strings.ToLower(v))
+		}
+	}
+	return asset
+}
+
+// sameSchema 比较两个表的结构定义, 返回第一个不一致的字段, 一致时返回-1, 字段的类型、用途和约束都需要一致, 不比较说明
+func sameSchema(a, b *cfgdef.TableDef) int {
+	var cols []int
+	for i := range a.Fields {
+		cols = append(cols, i)
+	}
+	for i := range b.Fields {
+		if _, ok := a.Fields[i]; !ok {
+			cols = append(cols, i)
+		}
+	}
+	sort.Ints(cols)
+	for _, i := range cols {
+		fa, fb := a.Fields[i], b.Fields[i]
+		if fa == nil || fb == nil {
+			if fa != fb {
+				return i
+			}
+			continue
+		}
+		ca, cb := *fa, *fb
+		ca.Desc, cb.Desc = "", ""
+		if !reflect.DeepEqual(ca, cb) {
+			return i
+		}
+	}
+	return -1
+}
+
+// isBlankRow 是否是空行
+func isBlankRow(data []string) bool {
+	for _, s := range data {
+		if cfgdef.Trim(s) != "" {
+			return false
+		}
+	}
+	return true
+}
+
 // loadTableCfg 加载表格配置
-func loadTableCfg(sheet *xlsx.Sheet) {
-	name := sheet.Name
+func loadTableCfg(filepath string, sheet *xlsx.Sheet) {
+	name := cfgdef.GetSheetName(sheet.Name)
+	source := filepath + "[" + sheet.Name + "]"
 	isTable := strings.HasSuffix(name, "Table")
+	isSettings := strings.HasSuffix(name, "Settings")
 	if sheet.MaxCol < 1 || sheet.MaxRow < 5 {
-		fmt.Println("error:", name, "格式不正确")
-		return
-	}
-	if _, ok := cfgMap.TableMap[name]; ok {
-		fmt.Println("error:", name, "重复定义")
+		cfgdef.Error(name, "格式不正确")
 		return
 	}
 
@@ -97,7 +348,7 @@ func loadTableCfg(sheet *xlsx.Sheet) {
 	for i := 0; i < sheet.MaxCol; i++ {
 		fullType := cfgdef.GetFullFieldType(sheet.Rows[3].Cells[i].String())
 		if fullType == "?" {
-			fmt.Println("error:", name, "字段类型无效", sheet.Rows[3].Cells[i].String())
+			cfgdef.Error(name, "字段类型无效", sheet.Rows[3].Cells[i].String())
 			fullType = ""
 		}
 		constraint := sheet.Rows[2].Cells[i].String() // 字段约束
@@ -107,7 +358,8 @@ func loadTableCfg(sheet *xlsx.Sheet) {
 			Desc:     lineTrim(sheet.Rows[1].Cells[i].String()),
 			IsArray:  strings.HasPrefix(fullType, "[]"),
 			IsStruct: strings.HasSuffix(fullType, "Struct"),
-			IsEnum:   strings.HasSuffix(fullType, "Enum"),
+			IsUnion:  strings.HasSuffix(fullType, "Union"),
+			IsEnum:   strings.HasSuffix(fullType, "Enum") || strings.HasSuffix(fullType, "Flags"),
 		}
 		//解析字段约束
 		temp1 := strings.Split(constraint, ";")
@@ -118,7 +370,7 @@ func loadTableCfg(sheet *xlsx.Sheet) {
 				field.IsKey = true
 				tableDef.Key = i
 				if field.IsArray {
-					fmt.Println("error:", name, "主键字段不可为数组")
+					cfgdef.Error(name, "主键字段不可为数组")
 				}
 			}
 			//字段用途 A:前后端通用 S:后端 C:前端
@@ -129,16 +381,42 @@ func loadTableCfg(sheet *xlsx.Sheet) {
 			if strings.HasPrefix(Cmd, "L[") && strings.HasSuffix(Cmd, "]") {
 				err := json.Unmarshal([]byte(Cmd[1:]), &field.Len)
 				if err != nil {
-					fmt.Println("error:", name, "字段约束定义有误", Cmd)
+					cfgdef.Error(name, "字段约束定义有误", Cmd)
 				}
 			}
 			//取值范围
 			if strings.HasPrefix(Cmd, "R[") && strings.HasSuffix(Cmd, "]") {
 				err := json.Unmarshal([]byte(Cmd[1:]), &field.Range)
 				if err != nil {
-					fmt.Println("error:", name, "字段约束定义有误", Cmd)
+					cfgdef.Error(name, "字段约束定义有误", Cmd)
 				}
 			}
+			//字符串显示宽度范围
+			if strings.HasPrefix(Cmd, "W[") && strings.HasSuffix(Cmd, "]") {
+				err := json.Unmarshal([]byte(Cmd[1:]), &field.Width)
+				if err != nil {
+					cfgdef.Error(name, "字段约束定义有误", Cmd)
+				}
+			}
+			//字符串格式, 正则表达式需要完整匹配
+			if strings.HasPrefix(Cmd, "P[") && strings.HasSuffix(Cmd, "]") {
+				field.Pattern = Cmd[2 : len(Cmd)-1]
+				if _, err := regexp.Compile(field.Pattern); err != nil {
+					cfgdef.Error(name, "字段约束定义有误", Cmd, err)
+				}
+			}
+			//可选值, 如: In[a,b,c] 或者 In["a,b","c"]
+			if strings.HasPrefix(Cmd, "In[") && strings.HasSuffix(Cmd, "]") {
+				field.In = parseInValues(Cmd[2:])
+			}
+			//文件路径, 检查文件是否存在于根目录下
+			if strings.HasPrefix(Cmd, "Path[") && strings.HasSuffix(Cmd, "]") {
+				field.PathRoot = cfgdef.Trim(Cmd[5 : len(Cmd)-1])
+			}
+			//资源引用, 如: Asset[Assets/Art/Icons,.png,.jpg]
+			if strings.HasPrefix(Cmd, "Asset[") && strings.HasSuffix(Cmd, "]") {
+				field.Asset = parseAssetDef(Cmd[6 : len(Cmd)-1])
+			}
 			if strings.HasPrefix(Cmd, "F[") && strings.HasSuffix(Cmd, "]") {
 				field.FTable = Cmd[2 : len(Cmd)-1]
 			}
@@ -148,10 +426,28 @@ func loadTableCfg(sheet *xlsx.Sheet) {
 	}
 
 	if isTable && tableDef.Key < 0 {
-		fmt.Println("error:", name, "缺少主键")
+		cfgdef.Error(name, "缺少主键")
 		return
 	}
 
+	//同名表或者拆分的表(如: ItemTable@weapons)分布在多个工作表中时, 结构一致则合并数据
+	if prev, ok := cfgMap.TableMap[name]; ok {
+		if isSettings {
+			cfgdef.Error(name, "重复定义", prev.Sheets, source)
+			return
+		}
+		if col := sameSchema(prev, tableDef); col >= 0 {
+			fieldName := ""
+			if field, ok := tableDef.Fields[col]; ok {
+				fieldName = field.Name
+			}
+			cfgdef.Error(name, "重复定义, 字段定义或约束不一致", cfgdef.GetColName(col), fieldName, prev.Sheets, source)
+			return
+		}
+		tableDef = prev
+	}
+	tableDef.Sheets = append(tableDef.Sheets, source)
+
 	//加载数据
 	fields := len(tableDef.Fields)
 	for i := 5; i < sheet.MaxRow; i++ {
@@ -163,14 +459,35 @@ func loadTableCfg(sheet *xlsx.Sheet) {
 		for j := 0; j < fields; j++ {
 			if j < len(cells) {
 				data[j] = cells[j].String()
+				//Excel日期单元格转换为日期文本, 导出时再按照时区转换
+				if tableDef.Fields[j].Type == "datetime" && !tableDef.Fields[j].IsArray && cells[j].IsTime() {
+					if t, err := cells[j].GetTime(sheet.File.Date1904); err == nil {
+						data[j] = t.Format("2006-01-02 15:04:05")
+					}
+				}
 			}
 		}
+		pos := &cfgdef.RowPos{File: filepath, Sheet: sheet.Name, Row: i}
+		if isTable {
+			key := cfgdef.Trim(data[tableDef.Key])
+			if key == "" {
+				if !isBlankRow(data) {
+					cfgdef.Error(name, "主键为空", pos.Cell(tableDef.Key))
+				}
+				continue
+			}
+			if n, ok := tableDef.KeyRows[key]; ok {
+				cfgdef.Error(name, "主键重复", key, tableDef.DataPos[n].Cell(tableDef.Key), pos.Cell(tableDef.Key))
+				continue
+			}
+			tableDef.KeyRows[key] = len(tableDef.Data)
+			tableDef.DataMap[key] = data
+		}
+		tableDef.DataPos[len(tableDef.Data)] = pos
 		tableDef.Data[len(tableDef.Data)] = data
-		if strings.HasSuffix(name, "Settings") {
+		if isSettings {
 			break
 		}
-		key := cells[tableDef.Key].String()
-		tableDef.DataMap[key] = data
 	}
 
 	cfgMap.TableMap[name] = tableDef
@@ -181,18 +498,24 @@ func loadAllCfg(filepath string) {
 	fmt.Println("加载配置文件:", filepath, "...")
 	xls, err := xlsx.OpenFile(filepath)
 	if err != nil {
-		fmt.Println("Failed to open ", filepath)
+		cfgdef.Error("Failed to open", filepath, err)
 		return
 	}
 	for _, sheet := range xls.Sheets {
 		fmt.Println("加载:", sheet.Name, "...")
+		name := cfgdef.GetSheetName(sheet.Name)
 		switch {
-		case strings.HasSuffix(sheet.Name, "Enum"):
-			loadEnumCfg(sheet)
-		case strings.HasSuffix(sheet.Name, "Settings"),
-			strings.HasSuffix(sheet.Name, "Struct"),
-			strings.HasSuffix(sheet.Name, "Table"):
-			loadTableCfg(sheet)
+		case strings.HasSuffix(name, "Enum"),
+			strings.HasSuffix(name, "Flags"):
+			loadEnumCfg(filepath, sheet)
+		case strings.HasSuffix(name, "Union"):
+			loadUnionCfg(sheet)
+		case strings.HasSuffix(name, "Rules"):
+			loadRulesCfg(filepath, sheet)
+		case strings.HasSuffix(name, "Settings"),
+			strings.HasSuffix(name, "Struct"),
+			strings.HasSuffix(name, "Table"):
+			loadTableCfg(filepath, sheet)
 		}
 	}
 }
@@ -216,6 +539,13 @@ func genCode(gen cfgdef.Generator) {
 			saveToFile(cfgdef.ExportFlags.OutputPath+"/"+filename, gen.GenEnum(n))
 		}
 	}
+	for n := range cfgMap.UnionMap {
+		filename := gen.GenFileName(n)
+		if filename != "" {
+			fmt.Println("生成:", n, "...")
+			saveToFile(cfgdef.ExportFlags.OutputPath+"/"+filename, gen.GenUnion(n))
+		}
+	}
 	for n := range cfgMap.TableMap {
 		filename := gen.GenFileName(n)
 		if filename != "" {
@@ -223,6 +553,12 @@ func genCode(gen cfgdef.Generator) {
 			saveToFile(cfgdef.ExportFlags.OutputPath+"/"+filename, gen.GenTable(n))
 		}
 	}
+	if g, ok := gen.(cfgdef.CommonGenerator); ok {
+		for filename, s := range g.GenCommonFiles() {
+			fmt.Println("生成:", filename, "...")
+			saveToFile(cfgdef.ExportFlags.OutputPath+"/"+filename, s)
+		}
+	}
 }
 
 func repairPath(p *string, create bool) {
@@ -253,12 +589,112 @@ func main() {
 	flag.StringVar(&cfgdef.ExportFlags.CSPath, "cs", "", "C#胶水代码输出路径")
 	flag.StringVar(&cfgdef.ExportFlags.UCSPath, "ucs", "", "Unity C#胶水代码输出路径")
 	flag.StringVar(&cfgdef.ExportFlags.UseFor, "use", "S", "S:服务端使用 C:客户端使用")
+	flag.StringVar(&cfgdef.ExportFlags.TimeZone, "tz", "UTC", "datetime字段的时区, 如: Asia/Shanghai, Local")
+	flag.UintVar(&cfgdef.ExportFlags.FixedBits, "fixedbits", 16, "fixed定点数的小数位数")
+	flag.StringVar(&cfgdef.ExportFlags.I18NPath, "i18n", "", "本地化文本输出路径, 已有的翻译文件会合并到新的翻译文件和文本包中, 需要同时导出JSON数据")
+	flag.StringVar(&cfgdef.ExportFlags.I18NFormat, "i18nfmt", "csv", "翻译文件格式 csv po xliff")
+	flag.StringVar(&cfgdef.ExportFlags.Langs, "langs", "zh,en", "本地化语言列表, 第一个为源语言")
+	flag.StringVar(&cfgdef.ExportFlags.AssetPath, "project", "", "客户端工程目录, 用于检查Asset约束的资源引用, 为空时不检查")
+	flag.BoolVar(&cfgdef.ExportFlags.AssetMeta, "assetmeta", false, "检查资源引用时要求存在Unity的.meta文件")
+	flag.BoolVar(&cfgdef.ExportFlags.BackRefs, "backrefs", false, "生成被引用的反向查询, 如: ItemStruct.ReferencedBy()")
+	flag.BoolVar(&cfgdef.ExportFlags.GoEmbed, "goembed", false, "JSON数据同时输出到GO胶水代码的"+gogen.EmbedDir+"目录, 通过go:embed嵌入, 使用LoadEmbedded()加载")
+	flag.BoolVar(&cfgdef.ExportFlags.CSNet, "csnet", false, "C#胶水代码使用.NET 6以上的System.Text.Json源生成加载, 生成record和DataTable运行时")
+	flag.StringVar(&cfgdef.ExportFlags.CSEnum, "csenum", "", "C#和Unity胶水代码的枚举项命名 prefix: 加上枚举名前缀, 如: ItemTypeEquip plain: 不加前缀, 为空时C#加上前缀, Unity不加前缀")
+	flag.StringVar(&cfgdef.ExportFlags.CSAttr, "csattr", "datacontract", "C#胶水代码的序列化特性 datacontract serializable, serializable需要同时使用-csfields, 和Unity胶水代码源码兼容")
+	flag.BoolVar(&cfgdef.ExportFlags.CSFields, "csfields", false, "C#胶水代码使用公开字段, 和Unity胶水代码相同, 默认使用只读属性")
+	flag.BoolVar(&cfgdef.ExportFlags.CSUnity, "csunity", false, "C#胶水代码和Unity胶水代码源码兼容, 等同于-csattr serializable -csfields, 枚举项命名和Unity相同")
+	flag.BoolVar(&cfgdef.ExportFlags.UAsset, "uasset", false, "Unity胶水代码同时生成ScriptableObject资源容器和导入资源的Editor脚本, 使用CfgManifest.LoadAssets()加载")
+	flag.BoolVar(&cfgdef.ExportFlags.CPPRuntime, "cppruntime", true, "生成C++运行时CfgRuntime.h, 使用自己的运行时时关闭")
+	flag.StringVar(&cfgdef.ExportFlags.CPPJSON, "cppjson", "rapidjson", "C++运行时默认使用的JSON库 rapidjson nlohmann")
+	flag.StringVar(&cfgdef.ExportFlags.CPPNS, "cppns", "GameConfig", "C++胶水代码的命名空间, 可以嵌套, 如: game::config, 为空时不使用命名空间")
+	flag.StringVar(&cfgdef.ExportFlags.CPPTypes, "cpptypes", "", "CPP内置值类型的替换类型, 如: vec2=glm::vec2,vec3=glm::vec3,color=glm::vec4,range=MyRange,include=glm/glm.hpp")
 	flag.Parse()
+	if cfgdef.ExportFlags.FixedBits == 0 || cfgdef.ExportFlags.FixedBits > 62 {
+		cfgdef.Error("fixedbits的取值范围为1~62")
+		os.Exit(1)
+	}
+
+	if cfgdef.ExportFlags.CPPJSON != "rapidjson" && cfgdef.ExportFlags.CPPJSON != "nlohmann" {
+		cfgdef.Error("cppjson不支持的JSON库", cfgdef.ExportFlags.CPPJSON)
+		os.Exit(1)
+	}
+
+	if cfgdef.ExportFlags.CSEnum != "" && cfgdef.ExportFlags.CSEnum != "prefix" && cfgdef.ExportFlags.CSEnum != "plain" {
+		cfgdef.Error("csenum不支持的命名", cfgdef.ExportFlags.CSEnum)
+		os.Exit(1)
+	}
+
+	if cfgdef.ExportFlags.CSAttr != "datacontract" && cfgdef.ExportFlags.CSAttr != "serializable" {
+		cfgdef.Error("csattr不支持的序列化特性", cfgdef.ExportFlags.CSAttr)
+		os.Exit(1)
+	}
+
+	if cfgdef.ExportFlags.CSUnity && cfgdef.ExportFlags.CSNet {
+		cfgdef.Error("csunity和csnet不能同时使用")
+		os.Exit(1)
+	}
+
+	if cfgdef.ExportFlags.CSAttr == "serializable" && !cfgdef.ExportFlags.CSFields {
+		cfgdef.Error("serializable按字段名序列化, 需要同时使用-csfields")
+		os.Exit(1)
+	}
+
+	if ns := cfgdef.ExportFlags.CPPNS; ns != "" && !regexp.MustCompile(`^[A-Za-z_]\w*(::[A-Za-z_]\w*)*$`).MatchString(ns) {
+		cfgdef.Error("cppns命名空间无效", ns)
+		os.Exit(1)
+	}
 
 	repairPath(&cfgdef.ExportFlags.XLSPath, false)
-	loadXlsList(cfgdef.ExportFlags.XLSPath)
-	for _, fn := range xlsMap {
-		loadAllCfg(fn)
+	if cfgdef.ExportFlags.AssetPath != "" {
+		repairPath(&cfgdef.ExportFlags.AssetPath, false)
+		if info, err := os.Stat(cfgdef.ExportFlags.AssetPath); err != nil || !info.IsDir() {
+			cfgdef.Error("客户端工程目录不存在", cfgdef.ExportFlags.AssetPath)
+			os.Exit(1)
+		}
+	}
+
+	if cfgdef.ExportFlags.GoEmbed && cfgdef.ExportFlags.GoPath == "" {
+		cfgdef.Error("嵌入JSON数据需要同时导出GO胶水代码")
+		os.Exit(1)
+	}
+
+	if cfgdef.ExportFlags.UAsset && cfgdef.ExportFlags.UCSPath == "" {
+		cfgdef.Error("生成ScriptableObject资源需要同时导出Unity C#胶水代码")
+		os.Exit(1)
+	}
+
+	//子命令 check: 只检查配置不生成文件, 有错误时退出码为1, 可以用于提交前检查
+	cmd := flag.Arg(0)
+	if cmd == "check" {
+		defer func() {
+			fmt.Printf("\n检查完成: %d个错误, %d个警告\n", cfgdef.ErrorCount, cfgdef.WarningCount)
+			if cfgdef.ErrorCount > 0 {
+				os.Exit(1)
+			}
+		}()
+	}
+
+	if err := loadXlsList(cfgdef.ExportFlags.XLSPath); err != nil {
+		cfgdef.Error("配置路径无效", err)
+		if cmd != "check" {
+			os.Exit(1)
+		}
+		return
+	}
+	//按照文件列表的顺序加载, 拆分的表格合并数据的顺序和报告的位置保持一致
+	for i := 0; i < len(xlsMap); i++ {
+		loadAllCfg(xlsMap[i])
+	}
+	checkUnionCfg()
+
+	switch cmd {
+	case "check":
+		runCheck()
+		return
+	case "refs":
+		//子命令 refs: 查询外键引用关系
+		showRefs(flag.Args()[1:])
+		return
 	}
 
 	if cfgdef.ExportFlags.GoPath != "" {
@@ -286,13 +722,54 @@ func main() {
 		fmt.Println("\n生成Unity C#胶水代码 ...")
 		repairPath(&cfgdef.ExportFlags.UCSPath, true)
 		cfgdef.ExportFlags.OutputPath = cfgdef.ExportFlags.UCSPath
+		if cfgdef.ExportFlags.UAsset {
+			editorPath := cfgdef.ExportFlags.UCSPath + "/" + unitygen.EditorDir
+			repairPath(&editorPath, true)
+		}
 		genCode(unitygen.NewUnityGen(cfgMap))
 	}
 
-	if cfgdef.ExportFlags.JSONPath != "" {
+	if cfgdef.ExportFlags.JSONPath != "" || cfgdef.ExportFlags.GoEmbed {
 		fmt.Println("\n生成JSON数据 ...")
-		repairPath(&cfgdef.ExportFlags.JSONPath, true)
-		cfgdef.ExportFlags.OutputPath = cfgdef.ExportFlags.JSONPath
-		genCode(jsongen.NewJSONGen(cfgMap))
+		embedPath := ""
+		if cfgdef.ExportFlags.GoEmbed {
+			embedPath = cfgdef.ExportFlags.GoPath + "/" + gogen.EmbedDir
+			repairPath(&embedPath, true)
+		}
+		if cfgdef.ExportFlags.JSONPath == "" {
+			cfgdef.ExportFlags.OutputPath = embedPath
+		} else {
+			repairPath(&cfgdef.ExportFlags.JSONPath, true)
+			cfgdef.ExportFlags.OutputPath = cfgdef.ExportFlags.JSONPath
+		}
+		gen := jsongen.NewJSONGen(cfgMap)
+		genCode(gen)
+		if len(cfgMap.Rules) > 0 {
+			fmt.Println("\n检查校验规则 ...")
+			gen.CheckRules()
+		}
+		//同时导出了JSON数据时复制到嵌入目录, 不重复检查
+		if embedPath != "" && cfgdef.ExportFlags.OutputPath != embedPath {
+			for n := range cfgMap.TableMap {
+				if filename := gen.GenFileName(n); filename != "" {
+					data, err := os.ReadFile(cfgdef.ExportFlags.OutputPath + "/" + filename)
+					if err != nil {
+						cfgdef.Error(err)
+						continue
+					}
+					saveToFile(embedPath+"/"+filename, string(data))
+				}
+			}
+		}
+	}
+
+	if cfgdef.ExportFlags.I18NPath != "" {
+		fmt.Println("\n生成本地化文本 ...")
+		if cfgdef.ExportFlags.JSONPath == "" {
+			cfgdef.Error("导出本地化文本需要同时导出JSON数据")
+			os.Exit(1)
+		}
+		repairPath(&cfgdef.ExportFlags.I18NPath, true)
+		i18n.NewExporter(cfgMap).Export(cfgdef.ExportFlags.I18NPath)
 	}
 }
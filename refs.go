@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gamewheels/cfgwheel/cfgdef"
+	"github.com/gamewheels/cfgwheel/jsongen"
+)
+
+// showRefs 查询外键引用关系, 如:
+//
+//	refs ItemTable 1001  列出引用该数据行的数据行
+//	refs ItemTable       列出没有被引用的数据行
+//	refs                 列出所有被关联的表格中没有被引用的数据行
+func showRefs(args []string) {
+	//生成JSON数据时收集外键引用
+	gen := jsongen.NewJSONGen(cfgMap)
+	names := sortedTables()
+	for _, name := range names {
+		if !strings.HasSuffix(name, "Struct") {
+			gen.GenTable(name)
+		}
+	}
+
+	if len(args) == 0 {
+		for _, name := range names {
+			if cfgMap.IsReferenced(name) {
+				showOrphans(name)
+			}
+		}
+		return
+	}
+
+	name := args[0]
+	if _, ok := cfgMap.TableMap[name]; !ok {
+		name += "Table"
+	}
+	tableDef, ok := cfgMap.TableMap[name]
+	if !ok || tableDef.Key < 0 {
+		cfgdef.Error("表格不存在", args[0])
+		return
+	}
+	if !cfgMap.IsReferenced(name) {
+		fmt.Println(name, "没有被其他表格关联")
+		return
+	}
+	if len(args) == 1 {
+		showOrphans(name)
+		return
+	}
+
+	//按照主键类型比较, 如: 1 和 1.0
+	keyField := tableDef.Fields[tableDef.Key]
+	key := ""
+	for k := range tableDef.KeyRows {
+		if gen.NormalizeKey(k, keyField) == gen.NormalizeKey(args[1], keyField) {
+			key = k
+		}
+	}
+	if key == "" {
+		cfgdef.Error(name, "没有数据行", args[1])
+		return
+	}
+	n := 0
+	for _, ref := range cfgMap.Refs {
+		if ref.Table == name && ref.Key == key {
+			fmt.Printf("  %s %s\t%s\n", ref.From, ref.Field, ref.Pos)
+			n++
+		}
+	}
+	fmt.Printf("%s %s 被引用%d次\n", name, key, n)
+}
+
+// showOrphans 列出没有被引用的数据行
+func showOrphans(name string) {
+	tableDef := cfgMap.TableMap[name]
+	referenced := make(map[string]bool)
+	for _, ref := range cfgMap.Refs {
+		if ref.Table == name {
+			referenced[ref.Key] = true
+		}
+	}
+	n := 0
+	for i := 0; i < len(tableDef.Data); i++ {
+		key := cfgdef.Trim(tableDef.Data[i][tableDef.Key])
+		if !referenced[key] {
+			fmt.Printf("  %s %s\t%s\n", name, key, tableDef.DataPos[i])
+			n++
+		}
+	}
+	fmt.Printf("%s 共%d行, 没有被引用%d行\n", name, len(tableDef.Data), n)
+}